@@ -0,0 +1,147 @@
+package gotsk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+const maxAckAttempts = 3
+
+// WithAckBatching buffers acknowledgements and flushes them once size acks
+// are waiting or window has passed, using a single call for stores that
+// implement interfaces.BatchAcker. Pending acks are flushed on Stop. A window
+// of zero or less flushes every ack right away.
+func WithAckBatching(size int, window time.Duration) Option {
+	return func(q *Queue) {
+		for _, nq := range q.queues {
+			nq.acks = newAckBatcher(nq.Store, size, window)
+		}
+	}
+}
+
+type ackBatcher struct {
+	store  interfaces.TaskStore
+	size   int
+	window time.Duration
+
+	mu      sync.Mutex
+	pending []pendingAck
+	flushMu sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type pendingAck struct {
+	task     interfaces.Task
+	attempts int
+}
+
+func newAckBatcher(store interfaces.TaskStore, size int, window time.Duration) *ackBatcher {
+	if window <= 0 {
+		size = 1
+	}
+	return &ackBatcher{
+		store:  store,
+		size:   max(size, 1),
+		window: window,
+		stop:   make(chan struct{}),
+	}
+}
+
+func (b *ackBatcher) start() {
+	if b.window <= 0 {
+		return
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(b.window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-ticker.C:
+				if err := b.flush(); err != nil {
+					log.Printf("⚠️ falha ao confirmar tasks em lote: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (b *ackBatcher) Ack(task interfaces.Task) error {
+	b.mu.Lock()
+	b.pending = append(b.pending, pendingAck{task: task})
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush sends every buffered ack. Failed acks stay buffered for the next
+// flush until they reach maxAckAttempts.
+func (b *ackBatcher) flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	tasks := make([]interfaces.Task, len(batch))
+	for i, ack := range batch {
+		tasks[i] = ack.task
+	}
+
+	var retry []pendingAck
+	var errs []error
+	for i, err := range interfaces.AckBatch(b.store, tasks) {
+		if err == nil {
+			continue
+		}
+		batch[i].attempts++
+		if batch[i].attempts < maxAckAttempts {
+			retry = append(retry, batch[i])
+			continue
+		}
+		errs = append(errs, fmt.Errorf("failed to ack task %s: %w", batch[i].task.ID, err))
+	}
+
+	b.mu.Lock()
+	b.pending = append(retry, b.pending...)
+	b.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+func (b *ackBatcher) close() error {
+	b.stopOnce.Do(func() { close(b.stop) })
+	b.wg.Wait()
+
+	var errs []error
+	for range maxAckAttempts {
+		if err := b.flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package gotsk
+
+import (
+	"fmt"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+type TaskSpec struct {
+	Name    string
+	Payload interfaces.Payload
+	Options interfaces.TaskOptions
+}
+
+// EnqueueBatch enqueues every spec, using a single store call per queue when
+// the store implements interfaces.BatchPusher. When some items fail the
+// returned error is an *interfaces.BatchError indexed like specs.
+func (q *Queue) EnqueueBatch(specs []TaskSpec) error {
+	result := &interfaces.BatchError{Errors: make([]error, len(specs))}
+
+	q.mu.RLock()
+	groups := make(map[*NamedQueue][]int)
+	var order []*NamedQueue
+	for i, spec := range specs {
+		if _, ok := q.handlers[spec.Name]; !ok {
+			result.Errors[i] = fmt.Errorf("handler for task '%s' not registered", spec.Name)
+			continue
+		}
+		nq, err := q.queue(spec.Options.Queue)
+		if err != nil {
+			result.Errors[i] = err
+			continue
+		}
+		if _, ok := groups[nq]; !ok {
+			order = append(order, nq)
+		}
+		groups[nq] = append(groups[nq], i)
+	}
+	q.mu.RUnlock()
+
+	for _, nq := range order {
+		indexes := groups[nq]
+		tasks := make([]interfaces.Task, len(indexes))
+		for j, i := range indexes {
+			tasks[j] = newTask(specs[i].Name, specs[i].Payload, specs[i].Options)
+		}
+
+		for j, err := range interfaces.PushBatch(nq.Store, tasks) {
+			result.Errors[indexes[j]] = err
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package gotsk
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const limitRetryDelay = time.Second
+
+func (q *Queue) admit(name string) (func(), time.Duration, bool) {
+	release, ok := q.acquire(name)
+	if !ok {
+		return nil, limitRetryDelay, false
+	}
+
+	q.mu.RLock()
+	cfg, ok := q.configs[name]
+	q.mu.RUnlock()
+
+	if !ok || cfg.rateLimiter == nil {
+		return release, 0, true
+	}
+
+	wait, err := cfg.rateLimiter.Reserve(q.ctx, name)
+	if err != nil {
+		log.Printf("⚠️ falha ao consultar rate limit para task '%s': %v", name, err)
+		wait = limitRetryDelay
+	}
+	if wait > 0 {
+		release()
+		return nil, wait, false
+	}
+
+	return release, 0, true
+}
+
+func (q *Queue) acquire(name string) (func(), bool) {
+	q.mu.RLock()
+	cfg, ok := q.configs[name]
+	q.mu.RUnlock()
+
+	if !ok {
+		return func() {}, true
+	}
+
+	if cfg.slots != nil {
+		select {
+		case cfg.slots <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+
+	releaseLocal := func() {
+		if cfg.slots != nil {
+			<-cfg.slots
+		}
+	}
+
+	if cfg.semaphore == nil {
+		return releaseLocal, true
+	}
+
+	token, ok, err := cfg.semaphore.Acquire(q.ctx, name, cfg.globalLimit)
+	if err != nil {
+		log.Printf("⚠️ falha ao adquirir semáforo global para task '%s': %v", name, err)
+	}
+	if err != nil || !ok {
+		releaseLocal()
+		return nil, false
+	}
+
+	return func() {
+		if err := cfg.semaphore.Release(context.Background(), name, token); err != nil {
+			log.Printf("⚠️ falha ao liberar semáforo global para task '%s': %v", name, err)
+		}
+		releaseLocal()
+	}, true
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/Thauan/gotsk"
 	"github.com/Thauan/gotsk/interfaces"
 	"github.com/Thauan/gotsk/middlewares"
+	"github.com/Thauan/gotsk/store"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
@@ -29,7 +30,7 @@ func main() {
 	}
 	defer logger.Sync()
 
-	store := interfaces.NewSQSStore(
+	store := store.NewSQSStore(
 		client,
 		"https://sqs.us-east-1.amazonaws.com/123456789012/my-queue",
 	)
@@ -0,0 +1,100 @@
+package gotsk
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+type inflight struct {
+	mu       sync.Mutex
+	count    int
+	draining bool
+	tasks    map[*runningTask]struct{}
+}
+
+// runningTask is claimed exactly once, either by the worker finishing it or by
+// Stop handing it back to the store, so a task is never both acked and requeued.
+type runningTask struct {
+	nq      *NamedQueue
+	task    interfaces.Task
+	claimed atomic.Bool
+}
+
+func (rt *runningTask) claim() bool {
+	return rt.claimed.CompareAndSwap(false, true)
+}
+
+func (f *inflight) track(nq *NamedQueue, task interfaces.Task) *runningTask {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rt := &runningTask{nq: nq, task: task}
+	if f.tasks == nil {
+		f.tasks = make(map[*runningTask]struct{})
+	}
+	f.tasks[rt] = struct{}{}
+	return rt
+}
+
+func (f *inflight) untrack(rt *runningTask) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.tasks, rt)
+}
+
+func (f *inflight) running() []*runningTask {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tasks := make([]*runningTask, 0, len(f.tasks))
+	for rt := range f.tasks {
+		tasks = append(tasks, rt)
+	}
+	return tasks
+}
+
+// begin reserves an in-flight slot before polling so Drain never returns
+// between a worker popping a task and starting it.
+func (f *inflight) begin() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return false
+	}
+	f.count++
+	return true
+}
+
+func (f *inflight) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count--
+}
+
+func (f *inflight) setDraining(draining bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.draining = draining
+}
+
+func (f *inflight) wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		f.mu.Lock()
+		idle := f.count == 0
+		f.mu.Unlock()
+		if idle {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package interfaces
+
+import (
+	"errors"
+	"fmt"
+)
+
+type BatchPusher interface {
+	PushBatch(tasks []Task) error
+}
+
+// BatchError reports per-item failures of a batch operation. Errors has one
+// entry per item, nil for the items that succeeded.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errors {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d items failed: %v", failed, len(e.Errors), first)
+}
+
+func (e *BatchError) Failed() bool {
+	for _, err := range e.Errors {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type BatchPopper interface {
+	PopBatch(max int) ([]Task, error)
+}
+
+type BatchAcker interface {
+	AckBatch(tasks []Task) error
+}
+
+// NewBatchError returns a *BatchError holding errs, one per item, or nil if
+// every item succeeded.
+func NewBatchError(errs []error) error {
+	result := &BatchError{Errors: errs}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+// The helpers below call the batch methods of stores that implement them and
+// fall back to the plain TaskStore methods otherwise, for the queue and for
+// stores wrapping other stores.
+
+// PushBatch pushes tasks to s and returns one error per task.
+func PushBatch(s TaskStore, tasks []Task) []error {
+	if bp, ok := s.(BatchPusher); ok {
+		return itemErrors(bp.PushBatch(tasks), len(tasks))
+	}
+
+	errs := make([]error, len(tasks))
+	for i, task := range tasks {
+		errs[i] = s.Push(task)
+	}
+	return errs
+}
+
+// PopBatch pops up to max tasks from s. Without a BatchPopper it pops one at
+// a time and stops at the first error, which it only returns if nothing was
+// popped.
+func PopBatch(s TaskStore, max int) ([]Task, error) {
+	if bp, ok := s.(BatchPopper); ok {
+		return bp.PopBatch(max)
+	}
+
+	var tasks []Task
+	for range max {
+		task, err := s.Pop()
+		if err != nil {
+			if len(tasks) == 0 {
+				return nil, err
+			}
+			break
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// AckBatch acks tasks on s and returns one error per task.
+func AckBatch(s TaskStore, tasks []Task) []error {
+	if ba, ok := s.(BatchAcker); ok {
+		return itemErrors(ba.AckBatch(tasks), len(tasks))
+	}
+
+	errs := make([]error, len(tasks))
+	for i, task := range tasks {
+		errs[i] = s.Ack(task)
+	}
+	return errs
+}
+
+// itemErrors spreads the error of a batch call over its n items.
+func itemErrors(err error, n int) []error {
+	errs := make([]error, n)
+	var batchErr *BatchError
+	switch {
+	case err == nil:
+	case errors.As(err, &batchErr) && len(batchErr.Errors) == n:
+		copy(errs, batchErr.Errors)
+	default:
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+	return errs
+}
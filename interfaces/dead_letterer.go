@@ -0,0 +1,7 @@
+package interfaces
+
+// DeadLetterer is implemented by stores that can set aside a task that failed
+// all its attempts, instead of keeping it pending.
+type DeadLetterer interface {
+	DeadLetter(task Task) error
+}
@@ -0,0 +1,7 @@
+package interfaces
+
+import "time"
+
+type LeaseExtender interface {
+	ExtendLease(task Task, lease time.Duration) error
+}
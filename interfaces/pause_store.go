@@ -0,0 +1,6 @@
+package interfaces
+
+type PauseStore interface {
+	SetPaused(name string, paused bool) error
+	PausedNames() ([]string, error)
+}
@@ -0,0 +1,10 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+)
+
+type RateLimiter interface {
+	Reserve(ctx context.Context, key string) (time.Duration, error)
+}
@@ -0,0 +1,8 @@
+package interfaces
+
+import "context"
+
+type Semaphore interface {
+	Acquire(ctx context.Context, key string, limit int) (token string, ok bool, err error)
+	Release(ctx context.Context, key string, token string) error
+}
@@ -10,4 +10,6 @@ type Task struct {
 	ReceiptHandle string    `json:"-"`
 	Priority      int       `json:"priority"`
 	ScheduledAt   time.Time `json:"scheduled_at"`
+	GroupKey      string    `json:"group_key,omitempty"`
+	UniqueKey     string    `json:"unique_key,omitempty"`
 }
@@ -5,4 +5,10 @@ import "time"
 type TaskOptions struct {
 	Priority    int
 	ScheduledAt time.Time
+	Queue       string
+	// GroupKey orders tasks: tasks sharing a key are processed one at a time,
+	// in the order they were enqueued.
+	GroupKey string
+	// UniqueKey is used as the deduplication ID by stores that support it.
+	UniqueKey string
 }
@@ -1,7 +1,10 @@
 package interfaces
 
+import "time"
+
 type TaskStore interface {
 	Push(task Task) error
 	Pop() (Task, error)
 	Ack(task Task) error
+	Nack(task Task, delay time.Duration) error
 }
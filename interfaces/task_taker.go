@@ -0,0 +1,9 @@
+package interfaces
+
+// TaskTaker is implemented by stores that can move their queued tasks matching
+// a filter, due or not, to pending without handing them out or counting a
+// delivery. Taken tasks are returned in queue order and settled with Ack or
+// Nack like popped ones.
+type TaskTaker interface {
+	Take(match func(Task) bool) ([]Task, error)
+}
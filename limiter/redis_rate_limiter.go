@@ -0,0 +1,112 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Both scripts use the Redis clock, so processes on hosts with skewed clocks
+// share one limit.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return wait
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return math.max(1, tonumber(oldest[2]) + window - now)
+`)
+
+// RedisTokenBucket shares a token bucket per key between every process using
+// the same Redis and prefix. Reserve fails if rate is not positive.
+type RedisTokenBucket struct {
+	client redis.UniversalClient
+	prefix string
+	rate   float64
+	burst  int
+}
+
+func NewRedisTokenBucket(client redis.UniversalClient, prefix string, rate float64, burst int) *RedisTokenBucket {
+	return &RedisTokenBucket{
+		client: client,
+		prefix: prefix,
+		rate:   rate,
+		burst:  max(burst, 1),
+	}
+}
+
+func (l *RedisTokenBucket) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	if !(l.rate > 0) {
+		return 0, errRate
+	}
+
+	redisKey := fmt.Sprintf("%s:ratelimit:%s", l.prefix, key)
+	wait, err := tokenBucketScript.Run(ctx, l.client, []string{redisKey}, l.rate, l.burst).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve token: %w", err)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// RedisSlidingWindow allows at most limit reservations per key in any window,
+// shared between every process using the same Redis and prefix. Reserve fails
+// if limit or window is not positive.
+type RedisSlidingWindow struct {
+	client redis.UniversalClient
+	prefix string
+	limit  int
+	window time.Duration
+}
+
+func NewRedisSlidingWindow(client redis.UniversalClient, prefix string, limit int, window time.Duration) *RedisSlidingWindow {
+	return &RedisSlidingWindow{
+		client: client,
+		prefix: prefix,
+		limit:  limit,
+		window: window,
+	}
+}
+
+func (l *RedisSlidingWindow) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	if l.limit <= 0 || l.window.Milliseconds() <= 0 {
+		return 0, errors.New("sliding window limit and window must be positive")
+	}
+
+	redisKey := fmt.Sprintf("%s:window:%s", l.prefix, key)
+	args := []any{l.limit, l.window.Milliseconds(), uuid.NewString()}
+	wait, err := slidingWindowScript.Run(ctx, l.client, []string{redisKey}, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve slot: %w", err)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
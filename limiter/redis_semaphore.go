@@ -0,0 +1,125 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Lease expiry uses the Redis clock, so holders on hosts with skewed clocks
+// agree on when a slot is free.
+var acquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call('ZADD', KEYS[1], now + tonumber(ARGV[3]), ARGV[2])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return 1
+end
+return 0
+`)
+
+var refreshScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) <= now then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[2]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// RedisSemaphore is a distributed counting semaphore. Each holder gets a lease
+// that expires after ttl, so slots held by a crashed process are reclaimed.
+// While a slot is held, its lease is refreshed every third of the ttl.
+type RedisSemaphore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+
+	mu   sync.Mutex
+	held map[string]context.CancelFunc
+}
+
+func NewRedisSemaphore(client redis.UniversalClient, prefix string, ttl time.Duration) *RedisSemaphore {
+	return &RedisSemaphore{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+		held:   make(map[string]context.CancelFunc),
+	}
+}
+
+func (s *RedisSemaphore) key(name string) string {
+	return fmt.Sprintf("%s:semaphore:%s", s.prefix, name)
+}
+
+func (s *RedisSemaphore) Acquire(ctx context.Context, name string, limit int) (string, bool, error) {
+	token := uuid.NewString()
+
+	ok, err := acquireScript.Run(ctx, s.client, []string{s.key(name)}, limit, token, s.ttl.Milliseconds()).Int()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to acquire semaphore: %w", err)
+	}
+	if ok == 0 {
+		return "", false, nil
+	}
+
+	keepCtx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.held[token] = cancel
+	s.mu.Unlock()
+	go s.keepAlive(keepCtx, name, token)
+
+	return token, true, nil
+}
+
+// keepAlive refreshes the lease of token until it is released or lost.
+func (s *RedisSemaphore) keepAlive(ctx context.Context, name, token string) {
+	ticker := time.NewTicker(max(s.ttl/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := refreshScript.Run(ctx, s.client, []string{s.key(name)}, token, s.ttl.Milliseconds()).Int()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("⚠️ falha ao renovar semáforo global '%s': %v", name, err)
+			}
+			continue
+		}
+		if ok == 0 {
+			log.Printf("⚠️ lease do semáforo global '%s' expirou antes de ser renovado", name)
+			return
+		}
+	}
+}
+
+func (s *RedisSemaphore) Release(ctx context.Context, name string, token string) error {
+	s.mu.Lock()
+	if cancel, ok := s.held[token]; ok {
+		cancel()
+		delete(s.held, token)
+	}
+	s.mu.Unlock()
+
+	if err := s.client.ZRem(ctx, s.key(name), token).Err(); err != nil {
+		return fmt.Errorf("failed to release semaphore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is an in-process rate limiter keeping one bucket per key.
+// Reserve returns zero when a token was taken, otherwise how long to wait
+// until one becomes available. It fails if rate is not positive.
+type TokenBucket struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+var errRate = errors.New("token bucket rate must be positive")
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *TokenBucket) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	if !(l.rate > 0) {
+		return 0, errRate
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), nil
+}
@@ -0,0 +1,40 @@
+package gotsk
+
+import "github.com/Thauan/gotsk/interfaces"
+
+type RegisterOption func(*taskConfig)
+
+type taskConfig struct {
+	slots       chan struct{}
+	semaphore   interfaces.Semaphore
+	globalLimit int
+	rateLimiter interfaces.RateLimiter
+}
+
+// MaxConcurrency caps how many tasks with this name run at once in this process.
+func MaxConcurrency(n int) RegisterOption {
+	return func(c *taskConfig) {
+		if n > 0 {
+			c.slots = make(chan struct{}, n)
+		}
+	}
+}
+
+// GlobalConcurrency caps how many tasks with this name run at once across every
+// process sharing the given semaphore.
+func GlobalConcurrency(sem interfaces.Semaphore, n int) RegisterOption {
+	return func(c *taskConfig) {
+		if n > 0 {
+			c.semaphore = sem
+			c.globalLimit = n
+		}
+	}
+}
+
+// RateLimit delays tasks with this name while the limiter has no capacity left.
+// Delayed tasks are rescheduled and do not count as failed attempts.
+func RateLimit(l interfaces.RateLimiter) RegisterOption {
+	return func(c *taskConfig) {
+		c.rateLimiter = l
+	}
+}
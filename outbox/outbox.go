@@ -0,0 +1,96 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/google/uuid"
+)
+
+// Outbox writes tasks to a table inside the caller's transaction. A Relay
+// later moves them to a TaskStore, so a task exists if and only if the
+// transaction that created it committed.
+type Outbox struct {
+	db      *sql.DB
+	dialect store.Dialect
+	table   string
+}
+
+type Option func(*Outbox)
+
+// WithTable sets the outbox table name. Defaults to "gotsk_outbox".
+func WithTable(table string) Option {
+	return func(o *Outbox) {
+		o.table = table
+	}
+}
+
+func New(db *sql.DB, dialect store.Dialect, opts ...Option) *Outbox {
+	o := &Outbox{
+		db:      db,
+		dialect: dialect,
+		table:   "gotsk_outbox",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Migrate creates the outbox table. Rows are claimed through locked_until and
+// marked with dispatched_at once pushed, or with failed_at if they cannot be
+// decoded.
+func (o *Outbox) Migrate(ctx context.Context) error {
+	seq := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	if o.dialect == store.Postgres {
+		seq = "BIGSERIAL PRIMARY KEY"
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			seq           %s,
+			id            TEXT NOT NULL UNIQUE,
+			data          TEXT NOT NULL,
+			created_at    BIGINT NOT NULL,
+			locked_until  BIGINT NOT NULL DEFAULT 0,
+			dispatched_at BIGINT,
+			failed_at     BIGINT
+		)`, o.table, seq),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_undispatched_idx ON %[1]s (dispatched_at, seq)`, o.table),
+	}
+	for _, stmt := range stmts {
+		if _, err := o.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate outbox: %w", err)
+		}
+	}
+	return nil
+}
+
+// Add writes a task to the outbox inside tx.
+func (o *Outbox) Add(ctx context.Context, tx *sql.Tx, name string, payload interfaces.Payload, options interfaces.TaskOptions) (interfaces.Task, error) {
+	task := interfaces.Task{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Payload:     payload,
+		Priority:    options.Priority,
+		ScheduledAt: options.ScheduledAt,
+		GroupKey:    options.GroupKey,
+		UniqueKey:   options.UniqueKey,
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return interfaces.Task{}, fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (id, data, created_at) VALUES (?, ?, ?)`, o.table)
+	if _, err := tx.ExecContext(ctx, o.dialect.Rebind(query), task.ID, string(data), time.Now().UnixMilli()); err != nil {
+		return interfaces.Task{}, fmt.Errorf("failed to insert outbox task: %w", err)
+	}
+	return task, nil
+}
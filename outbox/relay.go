@@ -0,0 +1,268 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+)
+
+// Relay moves tasks from the outbox to a TaskStore. Each round claims a batch
+// of rows by setting locked_until (with SKIP LOCKED on Postgres), so several
+// relays can run against the same table. Rows are marked dispatched only after
+// the push succeeded; a relay that dies in between leaves the claim to expire
+// and the rows are pushed again, giving at-least-once delivery. Each batch is
+// pushed in outbox order. Rows that cannot be decoded are marked with failed_at
+// and kept, so they are not claimed again.
+type Relay struct {
+	outbox    *Outbox
+	target    interfaces.TaskStore
+	batch     int
+	interval  time.Duration
+	lease     time.Duration
+	retention time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type RelayOption func(*Relay)
+
+// WithBatchSize sets how many rows are claimed per round. Defaults to 100.
+func WithBatchSize(n int) RelayOption {
+	return func(r *Relay) {
+		r.batch = max(n, 1)
+	}
+}
+
+// WithPollInterval sets how long the relay waits when the outbox is empty.
+// Defaults to 1 second.
+func WithPollInterval(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithClaimTimeout sets how long claimed rows stay reserved for a relay.
+// Defaults to 30 seconds.
+func WithClaimTimeout(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.lease = d
+	}
+}
+
+// WithRetention deletes dispatched rows older than d. Zero keeps them.
+// Defaults to 24 hours.
+func WithRetention(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.retention = d
+	}
+}
+
+func NewRelay(outbox *Outbox, target interfaces.TaskStore, opts ...RelayOption) *Relay {
+	r := &Relay{
+		outbox:    outbox,
+		target:    target,
+		batch:     100,
+		interval:  time.Second,
+		lease:     30 * time.Second,
+		retention: 24 * time.Hour,
+		stop:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Relay) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+func (r *Relay) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+	r.wg.Wait()
+}
+
+func (r *Relay) run() {
+	defer r.wg.Done()
+
+	for {
+		n, err := r.RelayOnce(context.Background())
+		if err != nil {
+			log.Printf("⚠️ Relay do outbox: %v", err)
+		}
+
+		wait := time.Duration(0)
+		if n == 0 || err != nil {
+			wait = r.interval
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RelayOnce claims one batch, pushes it and marks the pushed rows as
+// dispatched. It returns how many tasks were dispatched.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	seqs, tasks, err := r.claim(ctx)
+	if err != nil || len(tasks) == 0 {
+		return 0, err
+	}
+
+	pushed := r.push(tasks)
+
+	var done []int64
+	for i, ok := range pushed {
+		if ok {
+			done = append(done, seqs[i])
+		}
+	}
+
+	var errs []error
+	if len(done) < len(tasks) {
+		errs = append(errs, fmt.Errorf("failed to push %d of %d tasks", len(tasks)-len(done), len(tasks)))
+	}
+	if err := r.mark(ctx, "dispatched_at", done); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.cleanup(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return len(done), errors.Join(errs...)
+}
+
+func (r *Relay) claim(ctx context.Context) ([]int64, []interfaces.Task, error) {
+	o := r.outbox
+	now := time.Now()
+
+	lock := ""
+	if o.dialect == store.Postgres {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	query := fmt.Sprintf(`UPDATE %[1]s SET locked_until = ?
+		WHERE seq IN (SELECT seq FROM %[1]s WHERE dispatched_at IS NULL AND failed_at IS NULL AND locked_until <= ? ORDER BY seq LIMIT ?%[2]s)
+		RETURNING seq, data`, o.table, lock)
+
+	rows, err := o.db.QueryContext(ctx, o.dialect.Rebind(query), now.Add(r.lease).UnixMilli(), now.UnixMilli(), r.batch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to claim outbox rows: %w", err)
+	}
+	defer rows.Close()
+
+	type claimed struct {
+		seq  int64
+		task interfaces.Task
+	}
+	var items []claimed
+	var malformed []int64
+	for rows.Next() {
+		var seq int64
+		var data string
+		if err := rows.Scan(&seq, &data); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan outbox row: %w", err)
+		}
+
+		// A malformed row is marked failed instead of failing the rest of
+		// the batch or being claimed again.
+		var task interfaces.Task
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			log.Printf("⚠️ Linha %d do outbox inválida marcada como falha: %v", seq, err)
+			malformed = append(malformed, seq)
+			continue
+		}
+		items = append(items, claimed{seq, task})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to claim outbox rows: %w", err)
+	}
+	rows.Close()
+
+	if err := r.mark(ctx, "failed_at", malformed); err != nil {
+		log.Printf("⚠️ Relay do outbox: %v", err)
+	}
+
+	// RETURNING does not keep the subquery order.
+	sort.Slice(items, func(i, j int) bool { return items[i].seq < items[j].seq })
+
+	seqs := make([]int64, len(items))
+	tasks := make([]interfaces.Task, len(items))
+	for i, item := range items {
+		seqs[i] = item.seq
+		tasks[i] = item.task
+	}
+	return seqs, tasks, nil
+}
+
+// push reports, for each task, whether it reached the target store.
+func (r *Relay) push(tasks []interfaces.Task) []bool {
+	pushed := make([]bool, len(tasks))
+
+	if bp, ok := r.target.(interfaces.BatchPusher); ok {
+		err := bp.PushBatch(tasks)
+		var batchErr *interfaces.BatchError
+		switch {
+		case err == nil:
+			for i := range pushed {
+				pushed[i] = true
+			}
+		case errors.As(err, &batchErr) && len(batchErr.Errors) == len(tasks):
+			for i, err := range batchErr.Errors {
+				pushed[i] = err == nil
+			}
+		}
+		return pushed
+	}
+
+	for i, task := range tasks {
+		pushed[i] = r.target.Push(task) == nil
+	}
+	return pushed
+}
+
+// mark sets column (dispatched_at or failed_at) to now on the given rows.
+func (r *Relay) mark(ctx context.Context, column string, seqs []int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	args := []any{time.Now().UnixMilli()}
+	for _, seq := range seqs {
+		args = append(args, seq)
+	}
+
+	o := r.outbox
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(seqs)), ", ")
+	query := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE seq IN (%s)`, o.table, column, placeholders)
+	if _, err := o.db.ExecContext(ctx, o.dialect.Rebind(query), args...); err != nil {
+		return fmt.Errorf("failed to set %s on outbox rows: %w", column, err)
+	}
+	return nil
+}
+
+func (r *Relay) cleanup(ctx context.Context) error {
+	if r.retention <= 0 {
+		return nil
+	}
+
+	o := r.outbox
+	query := fmt.Sprintf(`DELETE FROM %s WHERE dispatched_at < ?`, o.table)
+	if _, err := o.db.ExecContext(ctx, o.dialect.Rebind(query), time.Now().Add(-r.retention).UnixMilli()); err != nil {
+		return fmt.Errorf("failed to delete dispatched outbox rows: %w", err)
+	}
+	return nil
+}
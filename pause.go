@@ -0,0 +1,109 @@
+package gotsk
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+const (
+	pauseAll             = "*"
+	pauseRefreshInterval = time.Second
+	pauseRetryDelay      = time.Second
+)
+
+type pauseState struct {
+	mu          sync.Mutex
+	local       map[string]bool
+	persisted   map[string]bool
+	refreshedAt time.Time
+}
+
+// Pause stops processing tasks with the given name. Stores implementing
+// interfaces.PauseStore persist the state so every replica respects it.
+func (q *Queue) Pause(name string) error {
+	return q.setPaused(name, true)
+}
+
+func (q *Queue) Resume(name string) error {
+	return q.setPaused(name, false)
+}
+
+func (q *Queue) PauseAll() error {
+	return q.setPaused(pauseAll, true)
+}
+
+// ResumeAll resumes the whole queue, including a queue stopped by Drain.
+func (q *Queue) ResumeAll() error {
+	q.inflight.setDraining(false)
+	return q.setPaused(pauseAll, false)
+}
+
+// Drain stops pulling new tasks and waits for the in-flight ones to finish.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.inflight.setDraining(true)
+	return q.inflight.wait(ctx)
+}
+
+func (q *Queue) setPaused(name string, paused bool) error {
+	q.pause.mu.Lock()
+	defer q.pause.mu.Unlock()
+
+	persisted := false
+	for _, nq := range q.queues {
+		ps, ok := nq.Store.(interfaces.PauseStore)
+		if !ok {
+			continue
+		}
+		if err := ps.SetPaused(name, paused); err != nil {
+			return err
+		}
+		persisted = true
+	}
+
+	state := q.pause.local
+	if persisted {
+		state = q.pause.persisted
+	}
+	if paused {
+		state[name] = true
+	} else {
+		delete(state, name)
+	}
+	return nil
+}
+
+func (q *Queue) isPaused(name string) bool {
+	q.pause.mu.Lock()
+	defer q.pause.mu.Unlock()
+
+	if time.Since(q.pause.refreshedAt) >= pauseRefreshInterval {
+		q.refreshPaused()
+	}
+
+	return q.pause.local[name] || q.pause.persisted[name]
+}
+
+func (q *Queue) refreshPaused() {
+	persisted := make(map[string]bool)
+	for _, nq := range q.queues {
+		ps, ok := nq.Store.(interfaces.PauseStore)
+		if !ok {
+			continue
+		}
+		names, err := ps.PausedNames()
+		if err != nil {
+			log.Printf("⚠️ falha ao carregar tasks pausadas da fila '%s': %v", nq.Name, err)
+			return
+		}
+		for _, name := range names {
+			persisted[name] = true
+		}
+	}
+
+	q.pause.persisted = persisted
+	q.pause.refreshedAt = time.Now()
+}
@@ -0,0 +1,223 @@
+package gotsk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+// WithPrefetch makes every queue fetch up to batchSize tasks per store call
+// into a local buffer of bufferSize tasks that the workers drain. While a task
+// sits in the buffer its lease is extended (for stores implementing
+// interfaces.LeaseExtender), and tasks still buffered on Stop are released
+// back to the store. A zero lease disables the extension.
+func WithPrefetch(batchSize, bufferSize int, lease time.Duration) Option {
+	return func(q *Queue) {
+		for _, nq := range q.queues {
+			nq.prefetch = newPrefetcher(nq.Store, batchSize, bufferSize, lease, q.ready)
+		}
+	}
+}
+
+// prefetcher hands buffered tasks out in the order they were fetched. Tasks
+// sharing a GroupKey are handed out one at a time: the next one only becomes
+// available once the previous has finished.
+type prefetcher struct {
+	store interfaces.TaskStore
+	batch int
+	size  int
+	lease time.Duration
+	ready chan<- struct{}
+
+	mu     sync.Mutex
+	buffer []interfaces.Task
+	active map[string]bool
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newPrefetcher(store interfaces.TaskStore, batch, size int, lease time.Duration, ready chan<- struct{}) *prefetcher {
+	return &prefetcher{
+		store:  store,
+		batch:  max(batch, 1),
+		size:   max(size, batch, 1),
+		lease:  lease,
+		ready:  ready,
+		active: make(map[string]bool),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (p *prefetcher) start() {
+	p.wg.Add(1)
+	go p.fetch()
+
+	if _, ok := p.store.(interfaces.LeaseExtender); ok && p.lease > 0 {
+		p.wg.Add(1)
+		go p.keepAlive()
+	}
+}
+
+func (p *prefetcher) Pop() (interfaces.Task, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, task := range p.buffer {
+		if task.GroupKey != "" && p.active[task.GroupKey] {
+			continue
+		}
+		if task.GroupKey != "" {
+			p.active[task.GroupKey] = true
+		}
+		p.buffer = append(p.buffer[:i], p.buffer[i+1:]...)
+		return task, nil
+	}
+
+	return interfaces.Task{}, errors.New("no tasks available")
+}
+
+// finish unlocks the task's group. When the task did not succeed, the rest of
+// its group is released back to the store so it is redelivered in order.
+// Stores put released grouped tasks back in front of the queue, so they are
+// released newest first.
+func (p *prefetcher) finish(task interfaces.Task, succeeded bool) {
+	if task.GroupKey == "" {
+		return
+	}
+
+	p.mu.Lock()
+	delete(p.active, task.GroupKey)
+
+	var released []interfaces.Task
+	if !succeeded {
+		kept := p.buffer[:0]
+		for _, t := range p.buffer {
+			if t.GroupKey == task.GroupKey {
+				released = append(released, t)
+			} else {
+				kept = append(kept, t)
+			}
+		}
+		p.buffer = kept
+	}
+	p.mu.Unlock()
+
+	for _, t := range slices.Backward(released) {
+		if err := p.store.Nack(t, 0); err != nil {
+			log.Printf("⚠️ falha ao devolver task %s do grupo %s: %v", t.ID, t.GroupKey, err)
+		}
+	}
+
+	// The store may now hand out the next task of the group.
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (p *prefetcher) fetch() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		p.mu.Lock()
+		free := min(p.size-len(p.buffer), p.batch)
+		p.mu.Unlock()
+
+		if free <= 0 {
+			p.wait(50 * time.Millisecond)
+			continue
+		}
+
+		tasks, _ := interfaces.PopBatch(p.store, free)
+		if len(tasks) == 0 {
+			p.wait(500 * time.Millisecond)
+			continue
+		}
+
+		p.mu.Lock()
+		p.buffer = append(p.buffer, tasks...)
+		p.mu.Unlock()
+
+		for range tasks {
+			select {
+			case p.ready <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (p *prefetcher) keepAlive() {
+	defer p.wg.Done()
+
+	extender := p.store.(interfaces.LeaseExtender)
+	ticker := time.NewTicker(p.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		tasks := make([]interfaces.Task, len(p.buffer))
+		copy(tasks, p.buffer)
+		p.mu.Unlock()
+
+		for _, task := range tasks {
+			if err := extender.ExtendLease(task, p.lease); err != nil {
+				log.Printf("⚠️ falha ao estender lease da task %s: %v", task.ID, err)
+			}
+		}
+	}
+}
+
+func (p *prefetcher) wait(d time.Duration) {
+	select {
+	case <-p.stop:
+	case <-p.wake:
+	case <-time.After(d):
+	}
+}
+
+// close stops fetching and releases every task that was never handed to a
+// worker.
+func (p *prefetcher) close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.wg.Wait()
+
+	p.mu.Lock()
+	tasks := p.buffer
+	p.buffer = nil
+	p.mu.Unlock()
+
+	var errs []error
+	for _, task := range slices.Backward(tasks) {
+		if err := p.store.Nack(task, 0); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release task %s: %w", task.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
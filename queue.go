@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Thauan/gotsk/interfaces"
 )
@@ -11,16 +12,27 @@ import (
 type HandlerFunc interfaces.HandlerFunc
 
 type Queue struct {
-	mu          sync.RWMutex
-	handlers    map[string]HandlerFunc
-	workers     int
-	wg          sync.WaitGroup
-	ctx         context.Context
-	cancel      context.CancelFunc
-	store       interfaces.TaskStore
-	done        chan bool
-	maxRetries  int
-	middlewares []interfaces.Middleware
+	mu           sync.RWMutex
+	handlers     map[string]HandlerFunc
+	configs      map[string]*taskConfig
+	workers      int
+	wg           sync.WaitGroup
+	ctx          context.Context
+	cancel       context.CancelFunc
+	taskCtx      context.Context
+	taskCancel   context.CancelFunc
+	shutdown     time.Duration
+	report       StopReport
+	reportMu     sync.Mutex
+	queues       []*NamedQueue
+	defaultQueue *NamedQueue
+	strategy     PollStrategy
+	done         chan bool
+	maxRetries   int
+	middlewares  []interfaces.Middleware
+	pause        pauseState
+	inflight     inflight
+	ready        chan struct{}
 }
 
 func (q *Queue) Use(mw interfaces.Middleware) {
@@ -31,36 +43,80 @@ func (q *Queue) GetWorkers() int {
 	return q.workers
 }
 
-func NewWithStore(workers int, store interfaces.TaskStore) *Queue {
+func NewWithStore(workers int, store interfaces.TaskStore, opts ...Option) *Queue {
+	return NewWithQueues(workers, []NamedQueue{{Name: DefaultQueue, Store: store, Weight: 1}}, opts...)
+}
+
+func NewWithQueues(workers int, queues []NamedQueue, opts ...Option) *Queue {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Queue{
+	taskCtx, taskCancel := context.WithCancel(context.Background())
+	q := &Queue{
 		handlers:   make(map[string]HandlerFunc),
+		configs:    make(map[string]*taskConfig),
 		workers:    workers,
 		ctx:        ctx,
 		cancel:     cancel,
+		taskCtx:    taskCtx,
+		taskCancel: taskCancel,
+		shutdown:   defaultShutdownTimeout,
 		maxRetries: 3,
-		store:      store,
 		done:       make(chan bool, workers),
+		ready:      make(chan struct{}, workers),
+		pause: pauseState{
+			local:     make(map[string]bool),
+			persisted: make(map[string]bool),
+		},
+	}
+
+	for _, nq := range queues {
+		nq.Weight = max(nq.Weight, 1)
+		q.queues = append(q.queues, &nq)
+		if nq.Name == DefaultQueue {
+			q.defaultQueue = q.queues[len(q.queues)-1]
+		}
+	}
+	if q.defaultQueue == nil && len(q.queues) > 0 {
+		q.defaultQueue = q.queues[0]
 	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
 }
 
-func (q *Queue) Register(name string, handler HandlerFunc) {
+func (q *Queue) Register(name string, handler HandlerFunc, opts ...RegisterOption) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	for i := len(q.middlewares) - 1; i >= 0; i-- {
 		handler = HandlerFunc(q.middlewares[i](interfaces.HandlerFunc(handler)))
 	}
 	q.handlers[name] = handler
+
+	cfg := &taskConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	q.configs[name] = cfg
 }
 
 func (q *Queue) Enqueue(name string, payload interfaces.Payload) error {
+	return q.EnqueueTo("", name, payload)
+}
+
+func (q *Queue) EnqueueTo(queue string, name string, payload interfaces.Payload) error {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 	if _, ok := q.handlers[name]; !ok {
 		return fmt.Errorf("handler for task '%s' not registered", name)
 	}
 
-	return q.store.Push(interfaces.Task{
+	nq, err := q.queue(queue)
+	if err != nil {
+		return err
+	}
+
+	return nq.Store.Push(interfaces.Task{
 		ID:      TaskId(),
 		Name:    name,
 		Payload: payload,
@@ -68,31 +124,38 @@ func (q *Queue) Enqueue(name string, payload interfaces.Payload) error {
 }
 
 func (q *Queue) Start() {
+	for _, nq := range q.queues {
+		if nq.prefetch != nil {
+			nq.prefetch.start()
+		}
+		if nq.acks != nil {
+			nq.acks.start()
+		}
+	}
+
 	for range q.workers {
 		q.wg.Add(1)
 		go q.worker()
 	}
 }
 
-func (q *Queue) Stop() {
-	q.cancel()
-	q.wg.Wait()
-
-	select {
-	case <-q.done:
-	default:
-		close(q.done)
+func (q *Queue) EnqueueAt(name string, payload interfaces.Payload, options interfaces.TaskOptions) error {
+	nq, err := q.queue(options.Queue)
+	if err != nil {
+		return err
 	}
+
+	return nq.Store.Push(newTask(name, payload, options))
 }
 
-func (q *Queue) EnqueueAt(name string, payload interfaces.Payload, options interfaces.TaskOptions) error {
-	task := interfaces.Task{
+func newTask(name string, payload interfaces.Payload, options interfaces.TaskOptions) interfaces.Task {
+	return interfaces.Task{
 		ID:          TaskId(),
 		Name:        name,
 		Payload:     payload,
 		Priority:    options.Priority,
 		ScheduledAt: options.ScheduledAt,
+		GroupKey:    options.GroupKey,
+		UniqueKey:   options.UniqueKey,
 	}
-
-	return q.store.Push(task)
 }
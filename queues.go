@@ -0,0 +1,106 @@
+package gotsk
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+const DefaultQueue = "default"
+
+type PollStrategy int
+
+const (
+	// StrictPriority polls queues in the order they were given and only moves
+	// to the next one when the previous is empty.
+	StrictPriority PollStrategy = iota
+	// WeightedPolling picks the queue to poll first at random, proportionally
+	// to its weight, so lower weights still make progress under load.
+	WeightedPolling
+)
+
+type NamedQueue struct {
+	Name   string
+	Store  interfaces.TaskStore
+	Weight int
+
+	prefetch *prefetcher
+	acks     *ackBatcher
+}
+
+func (nq *NamedQueue) finish(task interfaces.Task, succeeded bool) {
+	if nq.prefetch != nil {
+		nq.prefetch.finish(task, succeeded)
+	}
+}
+
+func (nq *NamedQueue) ack(task interfaces.Task) error {
+	if nq.acks != nil {
+		return nq.acks.Ack(task)
+	}
+	return nq.Store.Ack(task)
+}
+
+type Option func(*Queue)
+
+func WithPollStrategy(strategy PollStrategy) Option {
+	return func(q *Queue) {
+		q.strategy = strategy
+	}
+}
+
+func (q *Queue) queue(name string) (*NamedQueue, error) {
+	if name == "" {
+		return q.defaultQueue, nil
+	}
+	for _, nq := range q.queues {
+		if nq.Name == name {
+			return nq, nil
+		}
+	}
+	return nil, fmt.Errorf("queue '%s' not configured", name)
+}
+
+func (q *Queue) pop() (interfaces.Task, *NamedQueue, error) {
+	for _, nq := range q.pollOrder() {
+		var task interfaces.Task
+		var err error
+		if nq.prefetch != nil {
+			task, err = nq.prefetch.Pop()
+		} else {
+			task, err = nq.Store.Pop()
+		}
+		if err == nil {
+			return task, nq, nil
+		}
+	}
+	return interfaces.Task{}, nil, errors.New("no tasks available")
+}
+
+func (q *Queue) pollOrder() []*NamedQueue {
+	if q.strategy != WeightedPolling || len(q.queues) < 2 {
+		return q.queues
+	}
+
+	remaining := make([]*NamedQueue, len(q.queues))
+	copy(remaining, q.queues)
+
+	order := make([]*NamedQueue, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0
+		for _, nq := range remaining {
+			total += nq.Weight
+		}
+
+		i, n := 0, rand.IntN(total)
+		for ; n >= remaining[i].Weight; i++ {
+			n -= remaining[i].Weight
+		}
+
+		order = append(order, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return order
+}
@@ -16,6 +16,13 @@ func Run(queue *Queue) {
 	<-sig
 	log.Println("🔴 Encerrando...")
 
-	queue.Stop()
+	report := queue.Stop()
+	if len(report.Interrupted) > 0 {
+		log.Printf("⚠️ %d task(s) interrompida(s) e devolvida(s) à fila", len(report.Interrupted))
+	}
+	if report.Err != nil {
+		log.Printf("❌ Falha ao devolver tasks à fila: %v", report.Err)
+		return
+	}
 	log.Println("✅ Finalizado com sucesso")
 }
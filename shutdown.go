@@ -0,0 +1,82 @@
+package gotsk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// StopReport lists the tasks that were handed back to their store because
+// they did not finish before the shutdown deadline.
+type StopReport struct {
+	Interrupted []interfaces.Task
+	Err         error
+}
+
+// WithShutdownTimeout sets how long Stop waits for in-flight tasks before
+// cancelling their context and returning them to the store.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(q *Queue) {
+		q.shutdown = timeout
+	}
+}
+
+func (q *Queue) Stop() StopReport {
+	q.cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(q.shutdown):
+		log.Printf("⏰ Prazo de encerramento esgotado, devolvendo tasks em execução")
+		q.taskCancel()
+		for _, rt := range q.inflight.running() {
+			if rt.claim() {
+				q.interrupt(rt)
+			}
+		}
+	}
+	q.taskCancel()
+
+	q.reportMu.Lock()
+	for _, nq := range q.queues {
+		if nq.acks != nil {
+			q.report.Err = errors.Join(q.report.Err, nq.acks.close())
+		}
+		if nq.prefetch != nil {
+			q.report.Err = errors.Join(q.report.Err, nq.prefetch.close())
+		}
+	}
+	q.reportMu.Unlock()
+
+	select {
+	case <-q.done:
+	default:
+		close(q.done)
+	}
+
+	q.reportMu.Lock()
+	defer q.reportMu.Unlock()
+	return q.report
+}
+
+func (q *Queue) interrupt(rt *runningTask) {
+	err := rt.nq.Store.Nack(rt.task, 0)
+
+	q.reportMu.Lock()
+	defer q.reportMu.Unlock()
+	q.report.Interrupted = append(q.report.Interrupted, rt.task)
+	if err != nil {
+		q.report.Err = errors.Join(q.report.Err, fmt.Errorf("failed to requeue task %s: %w", rt.task.ID, err))
+	}
+}
@@ -0,0 +1,524 @@
+package sqstest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxBatchEntries   = 10
+	maxMessageSize    = 256 * 1024
+	maxDelaySeconds   = 900
+	maxWaitSeconds    = 20
+	maxVisibility     = 12 * 60 * 60
+	deduplicationTime = 5 * time.Minute
+)
+
+type queue struct {
+	name         string
+	fifo         bool
+	visibility   time.Duration
+	delay        time.Duration
+	contentDedup bool
+
+	mu       sync.Mutex
+	seq      int64
+	messages []*message
+	sent     map[string]sentMessage
+	changed  chan struct{}
+}
+
+type message struct {
+	id              string
+	body            string
+	attrs           map[string]attributeValue
+	groupID         string
+	dedupID         string
+	seq             int64
+	receipt         string
+	receives        int
+	sentAt          time.Time
+	firstReceivedAt time.Time
+	visibleAt       time.Time
+}
+
+// sentMessage remembers a FIFO deduplication ID for the deduplication window.
+type sentMessage struct {
+	id      string
+	seq     int64
+	expires time.Time
+}
+
+func newQueue(name string) *queue {
+	return &queue{
+		name:       name,
+		fifo:       strings.HasSuffix(name, ".fifo"),
+		visibility: 30 * time.Second,
+		sent:       make(map[string]sentMessage),
+		changed:    make(chan struct{}),
+	}
+}
+
+// notify wakes long-polling receives. Callers hold q.mu.
+func (q *queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+type attributeValue struct {
+	DataType    string  `json:"DataType"`
+	StringValue *string `json:"StringValue,omitempty"`
+	BinaryValue []byte  `json:"BinaryValue,omitempty"`
+}
+
+type sendEntry struct {
+	Id                     string                    `json:"Id,omitempty"`
+	MessageBody            string                    `json:"MessageBody"`
+	DelaySeconds           *int32                    `json:"DelaySeconds,omitempty"`
+	MessageAttributes      map[string]attributeValue `json:"MessageAttributes,omitempty"`
+	MessageGroupId         string                    `json:"MessageGroupId,omitempty"`
+	MessageDeduplicationId string                    `json:"MessageDeduplicationId,omitempty"`
+}
+
+type sendMessageInput struct {
+	QueueUrl string
+	sendEntry
+}
+
+type sendMessageBatchInput struct {
+	QueueUrl string
+	Entries  []sendEntry
+}
+
+type sendResult struct {
+	Id               string `json:"Id,omitempty"`
+	MessageId        string
+	MD5OfMessageBody string
+	SequenceNumber   string `json:"SequenceNumber,omitempty"`
+}
+
+type sendMessageBatchOutput struct {
+	Successful []sendResult
+	Failed     []batchResultError
+}
+
+type receiveMessageInput struct {
+	QueueUrl                    string
+	MaxNumberOfMessages         int32
+	WaitTimeSeconds             *int32
+	VisibilityTimeout           *int32
+	AttributeNames              []string
+	MessageSystemAttributeNames []string
+	MessageAttributeNames       []string
+}
+
+type receivedMessage struct {
+	MessageId         string
+	ReceiptHandle     string
+	MD5OfBody         string
+	Body              string
+	Attributes        map[string]string         `json:"Attributes,omitempty"`
+	MessageAttributes map[string]attributeValue `json:"MessageAttributes,omitempty"`
+}
+
+type receiveMessageOutput struct {
+	Messages []receivedMessage `json:"Messages,omitempty"`
+}
+
+type receiptEntry struct {
+	Id                string `json:"Id,omitempty"`
+	ReceiptHandle     string
+	VisibilityTimeout int32
+}
+
+type receiptInput struct {
+	QueueUrl string
+	receiptEntry
+}
+
+type receiptBatchInput struct {
+	QueueUrl string
+	Entries  []receiptEntry
+}
+
+type batchResult struct {
+	Id string
+}
+
+type batchResultError struct {
+	Id          string
+	SenderFault bool
+	Code        string
+	Message     string
+}
+
+type batchOutput struct {
+	Successful []batchResult
+	Failed     []batchResultError
+}
+
+func (in sendMessageInput) queueURL() string      { return in.QueueUrl }
+func (in sendMessageBatchInput) queueURL() string { return in.QueueUrl }
+func (in receiveMessageInput) queueURL() string   { return in.QueueUrl }
+func (in receiptInput) queueURL() string          { return in.QueueUrl }
+func (in receiptBatchInput) queueURL() string     { return in.QueueUrl }
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) sendMessage(_ *http.Request, q *queue, in sendMessageInput) (sendResult, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.send(in.sendEntry)
+}
+
+func (s *Server) sendMessageBatch(_ *http.Request, q *queue, in sendMessageBatchInput) (sendMessageBatchOutput, error) {
+	ids := make([]string, len(in.Entries))
+	for i, entry := range in.Entries {
+		ids[i] = entry.Id
+	}
+	if err := checkBatch(ids); err != nil {
+		return sendMessageBatchOutput{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := sendMessageBatchOutput{Successful: []sendResult{}, Failed: []batchResultError{}}
+	for _, entry := range in.Entries {
+		result, err := q.send(entry)
+		if err != nil {
+			out.Failed = append(out.Failed, failedEntry(entry.Id, err))
+			continue
+		}
+		result.Id = entry.Id
+		out.Successful = append(out.Successful, result)
+	}
+	return out, nil
+}
+
+// send enqueues a message. Callers hold q.mu.
+func (q *queue) send(entry sendEntry) (sendResult, error) {
+	if entry.MessageBody == "" {
+		return sendResult{}, &apiError{"MissingParameter", "The request must contain the parameter MessageBody."}
+	}
+	if len(entry.MessageBody) > maxMessageSize {
+		return sendResult{}, invalidParameter("One or more parameters are invalid. Reason: Message must be shorter than %d bytes.", maxMessageSize)
+	}
+
+	delay := q.delay
+	if entry.DelaySeconds != nil {
+		if q.fifo {
+			return sendResult{}, invalidParameter("Value %d for parameter DelaySeconds is invalid. Reason: The request include parameter that is not valid for this queue type.", *entry.DelaySeconds)
+		}
+		if *entry.DelaySeconds < 0 || *entry.DelaySeconds > maxDelaySeconds {
+			return sendResult{}, invalidParameter("Value %d for parameter DelaySeconds is invalid. Reason: must be between 0 and %d, if provided.", *entry.DelaySeconds, maxDelaySeconds)
+		}
+		delay = time.Duration(*entry.DelaySeconds) * time.Second
+	}
+
+	now := time.Now()
+	m := &message{
+		id:        uuid.NewString(),
+		body:      entry.MessageBody,
+		attrs:     entry.MessageAttributes,
+		sentAt:    now,
+		visibleAt: now.Add(delay),
+	}
+
+	if q.fifo {
+		if entry.MessageGroupId == "" {
+			return sendResult{}, &apiError{"MissingParameter", "The request must contain the parameter MessageGroupId."}
+		}
+		m.groupID = entry.MessageGroupId
+		m.dedupID = entry.MessageDeduplicationId
+		if m.dedupID == "" && q.contentDedup {
+			sum := sha256.Sum256([]byte(entry.MessageBody))
+			m.dedupID = hex.EncodeToString(sum[:])
+		}
+		if m.dedupID == "" {
+			return sendResult{}, invalidParameter("The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+		}
+
+		if sent, ok := q.sent[m.dedupID]; ok && now.Before(sent.expires) {
+			return sendResult{MessageId: sent.id, MD5OfMessageBody: md5Hex(entry.MessageBody), SequenceNumber: sequenceNumber(sent.seq)}, nil
+		}
+		q.seq++
+		m.seq = q.seq
+		q.sent[m.dedupID] = sentMessage{id: m.id, seq: m.seq, expires: now.Add(deduplicationTime)}
+	}
+
+	q.messages = append(q.messages, m)
+	q.notify()
+
+	result := sendResult{MessageId: m.id, MD5OfMessageBody: md5Hex(m.body)}
+	if q.fifo {
+		result.SequenceNumber = sequenceNumber(m.seq)
+	}
+	return result, nil
+}
+
+func sequenceNumber(seq int64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+func (s *Server) receiveMessage(r *http.Request, q *queue, in receiveMessageInput) (receiveMessageOutput, error) {
+	max := int(in.MaxNumberOfMessages)
+	if max == 0 {
+		max = 1
+	}
+	if max < 1 || max > maxBatchEntries {
+		return receiveMessageOutput{}, invalidParameter("Value %d for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and %d, if provided.", max, maxBatchEntries)
+	}
+
+	visibility := q.visibility
+	if in.VisibilityTimeout != nil {
+		if *in.VisibilityTimeout < 0 || *in.VisibilityTimeout > maxVisibility {
+			return receiveMessageOutput{}, invalidParameter("Value %d for parameter VisibilityTimeout is invalid.", *in.VisibilityTimeout)
+		}
+		visibility = time.Duration(*in.VisibilityTimeout) * time.Second
+	}
+
+	var wait time.Duration
+	if in.WaitTimeSeconds != nil {
+		if *in.WaitTimeSeconds < 0 || *in.WaitTimeSeconds > maxWaitSeconds {
+			return receiveMessageOutput{}, invalidParameter("Value %d for parameter WaitTimeSeconds is invalid. Reason: Must be >= 0 and <= %d, if provided.", *in.WaitTimeSeconds, maxWaitSeconds)
+		}
+		wait = time.Duration(*in.WaitTimeSeconds) * time.Second
+	}
+	if s.maxWait > 0 {
+		wait = min(wait, s.maxWait)
+	}
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		q.mu.Lock()
+		msgs := q.receive(max, visibility, in)
+		changed := q.changed
+		q.mu.Unlock()
+
+		if len(msgs) > 0 {
+			return receiveMessageOutput{Messages: msgs}, nil
+		}
+
+		// Hidden messages become visible without a notification, so poll too.
+		select {
+		case <-changed:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline.C:
+			return receiveMessageOutput{}, nil
+		case <-r.Context().Done():
+			return receiveMessageOutput{}, nil
+		}
+	}
+}
+
+// receive hands out up to max visible messages. In a FIFO queue, a group's
+// messages are only handed out while no earlier message of the group is
+// hidden. Callers hold q.mu.
+func (q *queue) receive(max int, visibility time.Duration, in receiveMessageInput) []receivedMessage {
+	now := time.Now()
+	blocked := make(map[string]bool)
+
+	var out []receivedMessage
+	for _, m := range q.messages {
+		if len(out) == max {
+			break
+		}
+		if q.fifo && blocked[m.groupID] {
+			continue
+		}
+		if m.visibleAt.After(now) {
+			blocked[m.groupID] = true
+			continue
+		}
+
+		m.receipt = uuid.NewString()
+		m.receives++
+		if m.firstReceivedAt.IsZero() {
+			m.firstReceivedAt = now
+		}
+		m.visibleAt = now.Add(visibility)
+
+		out = append(out, receivedMessage{
+			MessageId:         m.id,
+			ReceiptHandle:     m.receipt,
+			MD5OfBody:         md5Hex(m.body),
+			Body:              m.body,
+			Attributes:        q.systemAttributes(m, append(in.AttributeNames, in.MessageSystemAttributeNames...)),
+			MessageAttributes: messageAttributes(m, in.MessageAttributeNames),
+		})
+	}
+	return out
+}
+
+func (q *queue) systemAttributes(m *message, names []string) map[string]string {
+	attrs := map[string]string{
+		"SentTimestamp":                    strconv.FormatInt(m.sentAt.UnixMilli(), 10),
+		"ApproximateReceiveCount":          strconv.Itoa(m.receives),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceivedAt.UnixMilli(), 10),
+	}
+	if q.fifo {
+		attrs["MessageGroupId"] = m.groupID
+		attrs["MessageDeduplicationId"] = m.dedupID
+		attrs["SequenceNumber"] = sequenceNumber(m.seq)
+	}
+
+	if slices.Contains(names, "All") {
+		return attrs
+	}
+	selected := make(map[string]string)
+	for _, name := range names {
+		if value, ok := attrs[name]; ok {
+			selected[name] = value
+		}
+	}
+	return selected
+}
+
+// messageAttributes returns the attributes matching names, which may be
+// "All", ".*" or end in ".*" to select a prefix.
+func messageAttributes(m *message, names []string) map[string]attributeValue {
+	selected := make(map[string]attributeValue)
+	for key, value := range m.attrs {
+		for _, name := range names {
+			prefix, wildcard := strings.CutSuffix(name, ".*")
+			if name == "All" || name == ".*" || key == name || (wildcard && strings.HasPrefix(key, prefix+".")) {
+				selected[key] = value
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// find returns the message currently received with receipt. Callers hold
+// q.mu.
+func (q *queue) find(receipt string) (int, error) {
+	if receipt != "" {
+		for i, m := range q.messages {
+			if m.receipt == receipt {
+				return i, nil
+			}
+		}
+	}
+	return 0, &apiError{"ReceiptHandleIsInvalid", fmt.Sprintf("The input receipt handle \"%s\" is not a valid receipt handle.", receipt)}
+}
+
+func (s *Server) deleteMessage(_ *http.Request, q *queue, in receiptInput) (struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return struct{}{}, q.delete(in.ReceiptHandle)
+}
+
+func (s *Server) deleteMessageBatch(_ *http.Request, q *queue, in receiptBatchInput) (batchOutput, error) {
+	return q.batch(in.Entries, func(entry receiptEntry) error {
+		return q.delete(entry.ReceiptHandle)
+	})
+}
+
+// delete removes the message. Callers hold q.mu.
+func (q *queue) delete(receipt string) error {
+	i, err := q.find(receipt)
+	if err != nil {
+		return err
+	}
+	q.messages = slices.Delete(q.messages, i, i+1)
+	q.notify()
+	return nil
+}
+
+func (s *Server) changeMessageVisibility(_ *http.Request, q *queue, in receiptInput) (struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return struct{}{}, q.changeVisibility(in.ReceiptHandle, in.VisibilityTimeout)
+}
+
+func (s *Server) changeMessageVisibilityBatch(_ *http.Request, q *queue, in receiptBatchInput) (batchOutput, error) {
+	return q.batch(in.Entries, func(entry receiptEntry) error {
+		return q.changeVisibility(entry.ReceiptHandle, entry.VisibilityTimeout)
+	})
+}
+
+// changeVisibility hides a received message for timeout seconds from now.
+// Callers hold q.mu.
+func (q *queue) changeVisibility(receipt string, timeout int32) error {
+	if timeout < 0 || timeout > maxVisibility {
+		return invalidParameter("Value %d for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and %d.", timeout, maxVisibility)
+	}
+
+	i, err := q.find(receipt)
+	if err != nil {
+		return err
+	}
+	m := q.messages[i]
+	if !m.visibleAt.After(time.Now()) {
+		return &apiError{"AWS.SimpleQueueService.MessageNotInflight", "Message does not exist or is not available for visibility timeout change."}
+	}
+	m.visibleAt = time.Now().Add(time.Duration(timeout) * time.Second)
+	q.notify()
+	return nil
+}
+
+func (q *queue) batch(entries []receiptEntry, fn func(receiptEntry) error) (batchOutput, error) {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Id
+	}
+	if err := checkBatch(ids); err != nil {
+		return batchOutput{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := batchOutput{Successful: []batchResult{}, Failed: []batchResultError{}}
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			out.Failed = append(out.Failed, failedEntry(entry.Id, err))
+			continue
+		}
+		out.Successful = append(out.Successful, batchResult{Id: entry.Id})
+	}
+	return out, nil
+}
+
+func checkBatch(ids []string) error {
+	switch {
+	case len(ids) == 0:
+		return &apiError{"AWS.SimpleQueueService.EmptyBatchRequest", "There should be at least one entry in the request."}
+	case len(ids) > maxBatchEntries:
+		return &apiError{"AWS.SimpleQueueService.TooManyEntriesInBatchRequest", fmt.Sprintf("Maximum number of entries per request are %d.", maxBatchEntries)}
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			return &apiError{"AWS.SimpleQueueService.BatchEntryIdsNotDistinct", fmt.Sprintf("Id %s repeated.", id)}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+func failedEntry(id string, err error) batchResultError {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		apiErr = &apiError{"InternalError", err.Error()}
+	}
+	return batchResultError{Id: id, SenderFault: true, Code: apiErr.Code, Message: apiErr.Message}
+}
@@ -0,0 +1,186 @@
+// Package sqstest runs an in-process SQS stand-in for tests. It speaks the
+// subset of the SQS JSON protocol used by store.SQSStore: sending, receiving,
+// deleting and changing the visibility of messages, their batch variants,
+// FIFO groups and deduplication, delays and visibility timeouts.
+//
+//	srv := sqstest.NewServer()
+//	defer srv.Close()
+//	s := store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks"))
+package sqstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+const accountID = "000000000000"
+
+// Server is an SQS endpoint listening on a local address.
+type Server struct {
+	URL string
+
+	srv     *httptest.Server
+	maxWait time.Duration
+
+	mu     sync.Mutex
+	queues map[string]*queue
+}
+
+type Option func(*Server)
+
+// WithMaxWait caps how long ReceiveMessage long-polls, so tests do not wait
+// the full WaitTimeSeconds on an empty queue. Zero, the default, honours the
+// request.
+func WithMaxWait(d time.Duration) Option {
+	return func(s *Server) {
+		s.maxWait = d
+	}
+}
+
+type QueueOption func(*queue)
+
+// WithVisibilityTimeout sets the queue's default visibility timeout. Defaults
+// to 30 seconds.
+func WithVisibilityTimeout(d time.Duration) QueueOption {
+	return func(q *queue) {
+		q.visibility = d
+	}
+}
+
+// WithDelay sets the queue's default delivery delay.
+func WithDelay(d time.Duration) QueueOption {
+	return func(q *queue) {
+		q.delay = d
+	}
+}
+
+// WithContentBasedDeduplication deduplicates FIFO messages sent without a
+// deduplication ID by the SHA-256 of their body.
+func WithContentBasedDeduplication() QueueOption {
+	return func(q *queue) {
+		q.contentDedup = true
+	}
+}
+
+func NewServer(opts ...Option) *Server {
+	s := &Server{queues: make(map[string]*queue)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Client returns an SQS client that sends every request to the server.
+func (s *Server) Client() *sqs.Client {
+	return sqs.New(sqs.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(s.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+}
+
+// CreateQueue creates a queue and returns its URL. Names ending in ".fifo"
+// create FIFO queues.
+func (s *Server) CreateQueue(name string, opts ...QueueOption) string {
+	q := newQueue(name)
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues[name] = q
+	return fmt.Sprintf("%s/%s/%s", s.URL, accountID, name)
+}
+
+func (s *Server) queue(url string) (*queue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[url[strings.LastIndex(url, "/")+1:]]
+	if !ok {
+		return nil, &apiError{"AWS.SimpleQueueService.NonExistentQueue", "The specified queue does not exist."}
+	}
+	return q, nil
+}
+
+// apiError is returned to the client as an SQS error with the given code.
+type apiError struct {
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string { return e.Code + ": " + e.Message }
+
+func invalidParameter(format string, args ...any) *apiError {
+	return &apiError{"InvalidParameterValue", fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+
+	var out any
+	var err error
+	switch action {
+	case "SendMessage":
+		out, err = serve(s, r, s.sendMessage)
+	case "SendMessageBatch":
+		out, err = serve(s, r, s.sendMessageBatch)
+	case "ReceiveMessage":
+		out, err = serve(s, r, s.receiveMessage)
+	case "DeleteMessage":
+		out, err = serve(s, r, s.deleteMessage)
+	case "DeleteMessageBatch":
+		out, err = serve(s, r, s.deleteMessageBatch)
+	case "ChangeMessageVisibility":
+		out, err = serve(s, r, s.changeMessageVisibility)
+	case "ChangeMessageVisibilityBatch":
+		out, err = serve(s, r, s.changeMessageVisibilityBatch)
+	default:
+		err = &apiError{"InvalidAction", fmt.Sprintf("The action %s is not valid for this endpoint.", action)}
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if err != nil {
+		apiErr, ok := err.(*apiError)
+		if !ok {
+			apiErr = &apiError{"InvalidParameterValue", err.Error()}
+		}
+		w.Header().Set("X-Amzn-ErrorType", apiErr.Code)
+		w.Header().Set("X-Amzn-Query-Error", apiErr.Code+";Sender")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.sqs#" + apiErr.Code,
+			"message": apiErr.Message,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// serve decodes the request body into In, looks up its queue and calls fn.
+func serve[In interface{ queueURL() string }, Out any](s *Server, r *http.Request, fn func(*http.Request, *queue, In) (Out, error)) (any, error) {
+	var in In
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		return nil, &apiError{"SerializationException", err.Error()}
+	}
+	q, err := s.queue(in.queueURL())
+	if err != nil {
+		return nil, err
+	}
+	return fn(r, q, in)
+}
@@ -0,0 +1,445 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPChannel is the subset of *amqp.Channel used by AMQPStore.
+type AMQPChannel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Close() error
+}
+
+// AMQPDialer opens a channel. AMQPStore calls it again whenever the current
+// channel is closed.
+type AMQPDialer func() (AMQPChannel, error)
+
+// DialAMQP returns a dialer that opens a new connection to url with a single
+// channel. Closing the channel closes the connection.
+func DialAMQP(url string) AMQPDialer {
+	return func() (AMQPChannel, error) {
+		conn, err := amqp.Dial(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to broker: %w", err)
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to open channel: %w", err)
+		}
+		return &amqpConnChannel{Channel: ch, conn: conn}, nil
+	}
+}
+
+type amqpConnChannel struct {
+	*amqp.Channel
+	conn *amqp.Connection
+}
+
+func (c *amqpConnChannel) Close() error {
+	return c.conn.Close()
+}
+
+// AMQPStore keeps tasks in a durable RabbitMQ priority queue. Messages are
+// published as persistent with publisher confirms and consumed with manual
+// acks. Delayed tasks go to "<queue>.delay.<ms>" queues whose TTL dead-letters
+// them back into the queue; rejected messages are dead-lettered to
+// "<queue>.dead". When the channel closes, the store dials again on the next
+// call and deliveries that were not acked are redelivered by the broker.
+type AMQPStore struct {
+	dial        AMQPDialer
+	queue       string
+	prefetch    int
+	maxPriority uint8
+	precision   time.Duration
+	timeout     time.Duration
+
+	pubMu sync.Mutex
+
+	mu          sync.Mutex
+	ch          AMQPChannel
+	gen         uint64
+	confirms    chan amqp.Confirmation
+	deliveries  <-chan amqp.Delivery
+	delayQueues map[string]bool
+	inflight    map[string]amqp.Delivery
+	closed      bool
+}
+
+type AMQPOption func(*AMQPStore)
+
+// WithAMQPPrefetch sets how many unacked deliveries the broker sends ahead.
+// Defaults to 10.
+func WithAMQPPrefetch(n int) AMQPOption {
+	return func(s *AMQPStore) {
+		s.prefetch = max(n, 1)
+	}
+}
+
+// WithAMQPMaxPriority sets the queue's x-max-priority. Task priorities are
+// clamped to [0, p]. Defaults to 10.
+func WithAMQPMaxPriority(p uint8) AMQPOption {
+	return func(s *AMQPStore) {
+		s.maxPriority = max(p, 1)
+	}
+}
+
+// WithAMQPDelayPrecision sets how delays are rounded up. Each distinct delay
+// uses its own queue, so a coarser precision means fewer queues. Defaults to
+// 1 second.
+func WithAMQPDelayPrecision(d time.Duration) AMQPOption {
+	return func(s *AMQPStore) {
+		s.precision = max(d, time.Millisecond)
+	}
+}
+
+// WithAMQPConfirmTimeout sets how long a publish waits for the broker's
+// confirm. Defaults to 5 seconds.
+func WithAMQPConfirmTimeout(d time.Duration) AMQPOption {
+	return func(s *AMQPStore) {
+		s.timeout = d
+	}
+}
+
+// NewAMQPStore dials the broker and declares the queues.
+func NewAMQPStore(dial AMQPDialer, queue string, opts ...AMQPOption) (*AMQPStore, error) {
+	s := &AMQPStore{
+		dial:        dial,
+		queue:       queue,
+		prefetch:    10,
+		maxPriority: 10,
+		precision:   time.Second,
+		timeout:     5 * time.Second,
+		delayQueues: make(map[string]bool),
+		inflight:    make(map[string]amqp.Delivery),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect opens a channel and declares the topology. Callers hold s.mu.
+func (s *AMQPStore) connect() error {
+	if s.closed {
+		return errors.New("store is closed")
+	}
+	if s.ch != nil {
+		return nil
+	}
+
+	ch, err := s.dial()
+	if err != nil {
+		return err
+	}
+
+	if err := s.setup(ch); err != nil {
+		ch.Close()
+		return err
+	}
+
+	s.ch = ch
+	s.gen++
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		if err, ok := <-closed; ok && err != nil {
+			log.Printf("🔌 Canal AMQP fechado: %v", err)
+		}
+		s.mu.Lock()
+		s.reset(ch)
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+func (s *AMQPStore) setup(ch AMQPChannel) error {
+	if _, err := ch.QueueDeclare(s.queue+".dead", true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", err)
+	}
+
+	_, err := ch.QueueDeclare(s.queue, true, false, false, false, amqp.Table{
+		"x-max-priority":            int32(s.maxPriority),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": s.queue + ".dead",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare queue: %w", err)
+	}
+
+	if err := ch.Qos(s.prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	s.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	deliveries, err := ch.Consume(s.queue, "", false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start consumer: %w", err)
+	}
+	s.deliveries = deliveries
+	s.delayQueues = make(map[string]bool)
+	return nil
+}
+
+// reset drops ch if it is still the current channel. Unacked deliveries are
+// forgotten; the broker redelivers them. Callers hold s.mu.
+func (s *AMQPStore) reset(ch AMQPChannel) {
+	if s.ch != ch {
+		return
+	}
+	ch.Close()
+	s.ch = nil
+	s.inflight = make(map[string]amqp.Delivery)
+}
+
+func (s *AMQPStore) Push(task interfaces.Task) error {
+	if task.ID == "" {
+		task.ID = uuid.NewString()
+	}
+	return s.publish(task, time.Until(task.ScheduledAt))
+}
+
+// publish sends task to the queue, or to a delay queue when delay is
+// positive, and waits for the broker's confirm. A failed publish is retried
+// once on a new channel.
+func (s *AMQPStore) publish(task interfaces.Task, delay time.Duration) error {
+	task.ReceiptHandle = ""
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    task.ID,
+		Priority:     uint8(min(max(task.Priority, 0), int(s.maxPriority))),
+		Body:         data,
+	}
+
+	s.pubMu.Lock()
+	defer s.pubMu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		retry, err := s.publishOnce(msg, delay)
+		if err == nil || !retry || attempt == 1 {
+			return err
+		}
+	}
+}
+
+func (s *AMQPStore) publishOnce(msg amqp.Publishing, delay time.Duration) (bool, error) {
+	s.mu.Lock()
+	if err := s.connect(); err != nil {
+		s.mu.Unlock()
+		return true, err
+	}
+	ch, confirms := s.ch, s.confirms
+
+	key := s.queue
+	if delay > 0 {
+		var err error
+		if key, err = s.delayQueue(ch, delay); err != nil {
+			s.reset(ch)
+			s.mu.Unlock()
+			return true, err
+		}
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	fail := func(err error) (bool, error) {
+		s.mu.Lock()
+		s.reset(ch)
+		s.mu.Unlock()
+		return true, err
+	}
+
+	if err := ch.PublishWithContext(ctx, "", key, false, false, msg); err != nil {
+		return fail(fmt.Errorf("failed to publish task: %w", err))
+	}
+
+	select {
+	case confirm, ok := <-confirms:
+		if !ok {
+			return fail(errors.New("channel closed before publish confirm"))
+		}
+		if !confirm.Ack {
+			return false, errors.New("broker rejected task")
+		}
+		return false, nil
+	case <-ctx.Done():
+		return fail(errors.New("timed out waiting for publish confirm"))
+	}
+}
+
+// delayQueue declares the queue holding messages for delay, rounded up to the
+// store's precision. Its TTL dead-letters them into the main queue, and it is
+// deleted by the broker once unused. Callers hold s.mu.
+func (s *AMQPStore) delayQueue(ch AMQPChannel, delay time.Duration) (string, error) {
+	ttl := ((delay + s.precision - 1) / s.precision * s.precision).Milliseconds()
+	name := fmt.Sprintf("%s.delay.%d", s.queue, ttl)
+	if s.delayQueues[name] {
+		return name, nil
+	}
+
+	_, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-message-ttl":             ttl,
+		"x-expires":                 ttl + time.Minute.Milliseconds(),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": s.queue,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to declare delay queue: %w", err)
+	}
+	s.delayQueues[name] = true
+	return name, nil
+}
+
+func (s *AMQPStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
+
+// PopBatch returns up to max deliveries already sent by the broker, without
+// waiting for more.
+func (s *AMQPStore) PopBatch(max int) ([]interfaces.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	var tasks []interfaces.Task
+	for len(tasks) < max {
+		var d amqp.Delivery
+		var ok bool
+		select {
+		case d, ok = <-s.deliveries:
+		default:
+			return tasks, nil
+		}
+		if !ok {
+			s.reset(s.ch)
+			return tasks, nil
+		}
+
+		var task interfaces.Task
+		if err := json.Unmarshal(d.Body, &task); err != nil {
+			d.Reject(false)
+			return tasks, fmt.Errorf("failed to unmarshal task: %w", err)
+		}
+
+		task.ReceiptHandle = fmt.Sprintf("%d.%d", s.gen, d.DeliveryTag)
+		s.inflight[task.ReceiptHandle] = d
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *AMQPStore) delivery(task interfaces.Task) (amqp.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.inflight[task.ReceiptHandle]
+	if !ok {
+		return amqp.Delivery{}, errors.New("task not found in pending")
+	}
+	delete(s.inflight, task.ReceiptHandle)
+	return d, nil
+}
+
+func (s *AMQPStore) Ack(task interfaces.Task) error {
+	d, err := s.delivery(task)
+	if err != nil {
+		return err
+	}
+	if err := d.Ack(false); err != nil {
+		return fmt.Errorf("failed to ack task: %w", err)
+	}
+	return nil
+}
+
+// Nack requeues the delivery. With a delay, the task is published to a delay
+// queue first and the delivery is acked once the broker confirmed it.
+func (s *AMQPStore) Nack(task interfaces.Task, delay time.Duration) error {
+	d, err := s.delivery(task)
+	if err != nil {
+		return err
+	}
+
+	if delay <= 0 {
+		if err := d.Nack(false, true); err != nil {
+			return fmt.Errorf("failed to nack task: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.publish(task, delay); err != nil {
+		d.Nack(false, true)
+		return fmt.Errorf("failed to delay task: %w", err)
+	}
+	if err := d.Ack(false); err != nil {
+		return fmt.Errorf("failed to ack delayed task: %w", err)
+	}
+	return nil
+}
+
+// DeadLetter rejects the delivery without requeueing, so the broker moves it
+// to "<queue>.dead".
+func (s *AMQPStore) DeadLetter(task interfaces.Task) error {
+	d, err := s.delivery(task)
+	if err != nil {
+		return err
+	}
+	if err := d.Reject(false); err != nil {
+		return fmt.Errorf("failed to dead-letter task: %w", err)
+	}
+	return nil
+}
+
+func (s *AMQPStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.ch == nil {
+		return nil
+	}
+	err := s.ch.Close()
+	s.ch = nil
+	return err
+}
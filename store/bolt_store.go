@@ -0,0 +1,502 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	readyBucket     = []byte("ready")
+	scheduledBucket = []byte("scheduled")
+	pendingBucket   = []byte("pending")
+	leasesBucket    = []byte("leases")
+	deadBucket      = []byte("dead")
+	pausedBucket    = []byte("paused")
+	idsBucket       = []byte("ids")
+)
+
+// boltRecord is the value stored in every task bucket.
+type boltRecord struct {
+	Task       interfaces.Task `json:"task"`
+	Seq        uint64          `json:"seq"`
+	Deliveries int             `json:"deliveries"`
+	LeaseUntil int64           `json:"lease_until,omitempty"`
+}
+
+// BoltStore is an embedded store on a single bbolt file. Ready tasks are keyed
+// by priority and sequence, scheduled tasks by due time and pending tasks by
+// ID, with a lease index keyed by expiry. Every transition runs in one
+// transaction. A pending task whose lease expires goes back to ready, or to
+// the dead bucket once it was delivered the maximum number of times. Pushing a
+// task whose ID is already stored and not acked yet is a no-op.
+type BoltStore struct {
+	db            *bolt.DB
+	lease         time.Duration
+	maxDeliveries int
+}
+
+type BoltOption func(*BoltStore)
+
+// WithBoltLease sets how long a popped task stays pending before it is handed
+// out again. Defaults to 5 minutes.
+func WithBoltLease(lease time.Duration) BoltOption {
+	return func(s *BoltStore) {
+		s.lease = lease
+	}
+}
+
+// WithMaxDeliveries moves a task to the dead bucket when its lease expires
+// after n deliveries. Zero, the default, never gives up.
+func WithMaxDeliveries(n int) BoltOption {
+	return func(s *BoltStore) {
+		s.maxDeliveries = n
+	}
+}
+
+func NewBoltStore(path string, opts ...BoltOption) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	s := &BoltStore{
+		db:    db,
+		lease: 5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// bbolt locks the file, so tasks still pending belong to a process that
+	// stopped and are released right away.
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{readyBucket, scheduledBucket, pendingBucket, leasesBucket, deadBucket, pausedBucket, idsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return s.expireLeases(tx, math.MaxInt64, time.Now())
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open bolt store: %w", err)
+	}
+	return s, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// orderedInt encodes n so that byte order matches numeric order.
+func orderedInt(n int64) uint64 {
+	return uint64(n) ^ (1 << 63)
+}
+
+func readyKey(priority int, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, ^orderedInt(int64(priority)))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+func timeKey(at int64, suffix []byte) []byte {
+	key := make([]byte, 8, 8+len(suffix))
+	binary.BigEndian.PutUint64(key, orderedInt(at))
+	return append(key, suffix...)
+}
+
+func keyTime(key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key[:8]) ^ (1 << 63))
+}
+
+// putRecord stores a task as ready or scheduled. A task keeps the sequence of
+// its first push, so released tasks return to their original position.
+func putRecord(tx *bolt.Tx, rec boltRecord, now time.Time) error {
+	if rec.Seq == 0 {
+		seq, err := tx.Bucket(readyBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.Seq = seq
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	// Compared in milliseconds like the scheduled keys, or promoteScheduled
+	// would put a task due within the current millisecond straight back.
+	if rec.Task.ScheduledAt.UnixMilli() > now.UnixMilli() {
+		b := tx.Bucket(scheduledBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(timeKey(rec.Task.ScheduledAt.UnixMilli(), binary.BigEndian.AppendUint64(nil, seq)), data)
+	}
+
+	return tx.Bucket(readyBucket).Put(readyKey(rec.Task.Priority, rec.Seq), data)
+}
+
+// buryRecord moves a record that cannot be decoded to the dead bucket under
+// its current key, so it does not fail every pop.
+func buryRecord(c *bolt.Cursor, k, v []byte, err error) error {
+	log.Printf("⚠️ Registro inválido movido para o bucket dead: %v", err)
+	key := append([]byte(nil), k...)
+	data := append([]byte(nil), v...)
+	if err := c.Delete(); err != nil {
+		return err
+	}
+	return c.Bucket().Tx().Bucket(deadBucket).Put(key, data)
+}
+
+func getPending(tx *bolt.Tx, id string) (boltRecord, error) {
+	var rec boltRecord
+	data := tx.Bucket(pendingBucket).Get([]byte(id))
+	if data == nil {
+		return rec, errors.New("task not found in pending")
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return rec, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+	return rec, nil
+}
+
+func deletePending(tx *bolt.Tx, rec boltRecord) error {
+	id := []byte(rec.Task.ID)
+	if err := tx.Bucket(leasesBucket).Delete(timeKey(rec.LeaseUntil, id)); err != nil {
+		return err
+	}
+	return tx.Bucket(pendingBucket).Delete(id)
+}
+
+func putPending(tx *bolt.Tx, rec boltRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+	id := []byte(rec.Task.ID)
+	if err := tx.Bucket(leasesBucket).Put(timeKey(rec.LeaseUntil, id), id); err != nil {
+		return err
+	}
+	return tx.Bucket(pendingBucket).Put(id, data)
+}
+
+func (s *BoltStore) Push(task interfaces.Task) error {
+	return s.PushBatch([]interfaces.Task{task})
+}
+
+// PushBatch stores the whole batch in one transaction.
+func (s *BoltStore) PushBatch(tasks []interfaces.Task) error {
+	now := time.Now()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		ids := tx.Bucket(idsBucket)
+		for _, task := range tasks {
+			if task.ID == "" {
+				task.ID = uuid.NewString()
+			}
+			// Pending tasks are keyed by ID, so a second copy would overwrite
+			// the first one once both are popped.
+			if ids.Get([]byte(task.ID)) != nil {
+				continue
+			}
+			if err := ids.Put([]byte(task.ID), []byte{}); err != nil {
+				return err
+			}
+			if err := putRecord(tx, boltRecord{Task: task}, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push task: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
+
+// PopBatch releases expired leases, promotes due scheduled tasks and moves up
+// to max ready tasks to pending, all in one transaction.
+func (s *BoltStore) PopBatch(max int) ([]interfaces.Task, error) {
+	now := time.Now()
+	var tasks []interfaces.Task
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := s.expireLeases(tx, now.UnixMilli(), now); err != nil {
+			return err
+		}
+		if err := promoteScheduled(tx, now); err != nil {
+			return err
+		}
+
+		c := tx.Bucket(readyBucket).Cursor()
+		for k, v := c.First(); k != nil && len(tasks) < max; k, v = c.First() {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				if err := buryRecord(c, k, v, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+
+			rec.Deliveries++
+			rec.LeaseUntil = now.Add(s.lease).UnixMilli()
+			if err := putPending(tx, rec); err != nil {
+				return err
+			}
+			tasks = append(tasks, rec.Task)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop task: %w", err)
+	}
+	return tasks, nil
+}
+
+// expireLeases releases pending tasks whose lease ends by until. A lease that
+// no longer matches a pending task is dropped.
+func (s *BoltStore) expireLeases(tx *bolt.Tx, until int64, now time.Time) error {
+	c := tx.Bucket(leasesBucket).Cursor()
+	for k, v := c.First(); k != nil && keyTime(k) <= until; k, v = c.First() {
+		id := append([]byte(nil), v...)
+		rec, err := getPending(tx, string(id))
+		if err != nil || rec.LeaseUntil != keyTime(k) {
+			log.Printf("⚠️ Lease órfão da task %s removido", id)
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := deletePending(tx, rec); err != nil {
+			return err
+		}
+
+		if s.maxDeliveries > 0 && rec.Deliveries >= s.maxDeliveries {
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(deadBucket).Put(id, data); err != nil {
+				return err
+			}
+			if err := tx.Bucket(idsBucket).Delete(id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rec.LeaseUntil = 0
+		if err := putRecord(tx, rec, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func promoteScheduled(tx *bolt.Tx, now time.Time) error {
+	c := tx.Bucket(scheduledBucket).Cursor()
+	for k, v := c.First(); k != nil && keyTime(k) <= now.UnixMilli(); k, v = c.First() {
+		var rec boltRecord
+		if err := json.Unmarshal(v, &rec); err != nil {
+			if err := buryRecord(c, k, v, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		if err := putRecord(tx, rec, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Take moves the ready and scheduled tasks matching match to pending under a
+// new lease, without counting a delivery. Ready tasks come first, in Pop order.
+func (s *BoltStore) Take(match func(interfaces.Task) bool) ([]interfaces.Task, error) {
+	now := time.Now()
+	var tasks []interfaces.Task
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{readyBucket, scheduledBucket} {
+			b := tx.Bucket(name)
+			var keys [][]byte
+			var recs []boltRecord
+			err := b.ForEach(func(k, v []byte) error {
+				var rec boltRecord
+				if err := json.Unmarshal(v, &rec); err == nil && match(rec.Task) {
+					keys = append(keys, append([]byte(nil), k...))
+					recs = append(recs, rec)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for i, rec := range recs {
+				if err := b.Delete(keys[i]); err != nil {
+					return err
+				}
+				rec.LeaseUntil = now.Add(s.lease).UnixMilli()
+				if err := putPending(tx, rec); err != nil {
+					return err
+				}
+				tasks = append(tasks, rec.Task)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to take tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (s *BoltStore) Ack(task interfaces.Task) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return ackPending(tx, task.ID)
+	})
+}
+
+func ackPending(tx *bolt.Tx, id string) error {
+	rec, err := getPending(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := deletePending(tx, rec); err != nil {
+		return err
+	}
+	return tx.Bucket(idsBucket).Delete([]byte(id))
+}
+
+func (s *BoltStore) AckBatch(tasks []interfaces.Task) error {
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for i, task := range tasks {
+			if _, err := getPending(tx, task.ID); err != nil {
+				result.Errors[i] = err
+				continue
+			}
+			if err := ackPending(tx, task.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range result.Errors {
+			result.Errors[i] = fmt.Errorf("failed to ack task: %w", err)
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *BoltStore) Nack(task interfaces.Task, delay time.Duration) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		rec, err := getPending(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		if err := deletePending(tx, rec); err != nil {
+			return err
+		}
+
+		rec.LeaseUntil = 0
+		if delay > 0 {
+			rec.Task.ScheduledAt = now.Add(delay)
+		}
+		return putRecord(tx, rec, now)
+	})
+}
+
+func (s *BoltStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		rec, err := getPending(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		if err := deletePending(tx, rec); err != nil {
+			return err
+		}
+		rec.LeaseUntil = time.Now().Add(lease).UnixMilli()
+		return putPending(tx, rec)
+	})
+}
+
+// DeadTasks lists the tasks that exceeded the maximum number of deliveries.
+// Records that could not be decoded are skipped.
+func (s *BoltStore) DeadTasks() ([]interfaces.Task, error) {
+	var tasks []interfaces.Task
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deadBucket).ForEach(func(_, v []byte) error {
+			var rec boltRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return nil
+			}
+			tasks = append(tasks, rec.Task)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (s *BoltStore) SetPaused(name string, paused bool) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if paused {
+			return tx.Bucket(pausedBucket).Put([]byte(name), []byte{})
+		}
+		return tx.Bucket(pausedBucket).Delete([]byte(name))
+	})
+}
+
+func (s *BoltStore) PausedNames() ([]string, error) {
+	var names []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pausedBucket).ForEach(func(k, _ []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paused tasks: %w", err)
+	}
+	return names, nil
+}
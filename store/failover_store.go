@@ -0,0 +1,362 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+)
+
+// FailoverStore pushes tasks to a primary store and spills them to a local
+// durable fallback, such as a BoltStore, while the primary fails. After a
+// failed push every push goes to the fallback until a background replayer has
+// moved the spilled tasks back to the primary, keeping their IDs and the order
+// they were pushed in, so newer tasks never overtake spilled ones. Spilled
+// tasks are kept in the fallback without priority or schedule, which the
+// primary applies once they are replayed.
+// A circuit breaker stops trying the primary for a cooldown after repeated
+// failures. Pop, Ack and Nack always use the primary, and so do the optional
+// batch, lease and pause methods when the primary implements them. The
+// fallback should implement BatchPopper, so the replayer can tell an empty
+// fallback from a failing one.
+type FailoverStore struct {
+	primary   interfaces.TaskStore
+	fallback  interfaces.TaskStore
+	threshold int
+	cooldown  time.Duration
+	interval  time.Duration
+
+	mu        sync.Mutex
+	spilling  bool
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	paused pauseSet
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type FailoverOption func(*FailoverStore)
+
+// WithBreaker opens the circuit after threshold consecutive failed pushes to
+// the primary and keeps it open for cooldown, after which one push is tried
+// again. Defaults to 3 failures and 10 seconds.
+func WithBreaker(threshold int, cooldown time.Duration) FailoverOption {
+	return func(s *FailoverStore) {
+		s.threshold = max(threshold, 1)
+		s.cooldown = cooldown
+	}
+}
+
+// WithReplayInterval sets how often the fallback is drained into the primary.
+// Defaults to 1 second.
+func WithReplayInterval(d time.Duration) FailoverOption {
+	return func(s *FailoverStore) {
+		s.interval = d
+	}
+}
+
+// NewFailoverStore starts replaying tasks left in fallback by an earlier
+// process. Call Close to stop the replayer; the wrapped stores are not closed.
+func NewFailoverStore(primary, fallback interfaces.TaskStore, opts ...FailoverOption) *FailoverStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &FailoverStore{
+		primary:   primary,
+		fallback:  fallback,
+		threshold: 3,
+		cooldown:  10 * time.Second,
+		interval:  time.Second,
+		spilling:  true,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.replayLoop(ctx)
+	return s
+}
+
+func (s *FailoverStore) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// allow reports whether the primary may be tried. Once the cooldown is over a
+// single trial is let through, and the circuit stays half-open until record
+// sees its result. Must be called with mu held.
+func (s *FailoverStore) allow() bool {
+	if s.failures < s.threshold {
+		return true
+	}
+	if s.probing || time.Now().Before(s.openUntil) {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+func (s *FailoverStore) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.probing = false
+
+	if err == nil {
+		if s.failures >= s.threshold {
+			log.Printf("✅ Store primário recuperado")
+		}
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= s.threshold {
+		s.openUntil = time.Now().Add(s.cooldown)
+		log.Printf("🔌 Circuito do store primário aberto por %s", s.cooldown)
+	}
+}
+
+func (s *FailoverStore) Push(task interfaces.Task) error {
+	if task.ID == "" {
+		task.ID = uuid.NewString()
+	}
+
+	s.mu.Lock()
+	direct := !s.spilling && s.allow()
+	s.mu.Unlock()
+
+	if direct {
+		err := s.primary.Push(task)
+		s.record(err)
+		if err == nil {
+			return nil
+		}
+		log.Printf("⚠️ Falha ao enviar tarefa %s ao store primário, usando fallback: %v", task.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spilling = true
+	if err := s.spill(task); err != nil {
+		return fmt.Errorf("failed to push task to fallback: %w", err)
+	}
+	return nil
+}
+
+// spilledField is the payload field holding a spilled task.
+const spilledField = "gotsk_spilled"
+
+// spill pushes task to the fallback wrapped in a task without priority or
+// schedule, so a fallback ordering by either, like a BoltStore, still hands
+// the spilled tasks out in push order. Must be called with mu held.
+func (s *FailoverStore) spill(task interfaces.Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+	return s.fallback.Push(interfaces.Task{
+		ID:      task.ID,
+		Name:    task.Name,
+		Payload: interfaces.Payload{spilledField: string(data)},
+	})
+}
+
+// unspill returns the task wrapped by spill. Tasks spilled as they are, by
+// earlier versions, are returned unchanged.
+func unspill(task interfaces.Task) (interfaces.Task, error) {
+	data, ok := task.Payload[spilledField].(string)
+	if !ok {
+		return task, nil
+	}
+	var spilled interfaces.Task
+	if err := json.Unmarshal([]byte(data), &spilled); err != nil {
+		return task, fmt.Errorf("failed to unmarshal spilled task: %w", err)
+	}
+	return spilled, nil
+}
+
+func (s *FailoverStore) replayLoop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.replay(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// replay moves spilled tasks to the primary until the fallback is empty or a
+// push fails. A task that could not be pushed is nacked back to the fallback.
+func (s *FailoverStore) replay(ctx context.Context) {
+	replayed := 0
+	defer func() {
+		if replayed > 0 {
+			log.Printf("🔁 %d tarefas reenviadas do fallback ao store primário", replayed)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		if !s.allow() {
+			s.mu.Unlock()
+			return
+		}
+		task, empty, err := s.popFallback()
+		if empty || err != nil {
+			// The trial allow may have granted was not used.
+			s.probing = false
+			if err != nil {
+				log.Printf("⚠️ Falha ao ler tarefas do fallback: %v", err)
+			} else {
+				// Pushes made while the lock is held go to the
+				// fallback, so none can land behind the primary's
+				// newer tasks.
+				s.spilling = false
+			}
+			s.mu.Unlock()
+			return
+		}
+		spilled, err := unspill(task)
+		if err != nil {
+			s.probing = false
+			s.mu.Unlock()
+			log.Printf("⚠️ Tarefa %s inválida descartada do fallback: %v", task.ID, err)
+			if err := s.fallback.Ack(task); err != nil {
+				log.Printf("⚠️ Falha ao remover tarefa %s do fallback: %v", task.ID, err)
+			}
+			continue
+		}
+		s.mu.Unlock()
+
+		spilled.ReceiptHandle = ""
+		err = s.primary.Push(spilled)
+		s.record(err)
+		if err != nil {
+			log.Printf("⚠️ Falha ao reenviar tarefa %s ao store primário: %v", task.ID, err)
+			if err := s.fallback.Nack(task, 0); err != nil {
+				log.Printf("⚠️ Falha ao devolver tarefa %s ao fallback: %v", task.ID, err)
+			}
+			return
+		}
+		if err := s.fallback.Ack(task); err != nil {
+			log.Printf("⚠️ Falha ao remover tarefa %s do fallback: %v", task.ID, err)
+		}
+		replayed++
+	}
+}
+
+// popFallback pops the oldest spilled task. A fallback without PopBatch cannot
+// tell an empty store from a failing one, so its Pop errors count as empty.
+func (s *FailoverStore) popFallback() (interfaces.Task, bool, error) {
+	bp, ok := s.fallback.(interfaces.BatchPopper)
+	if !ok {
+		task, err := s.fallback.Pop()
+		return task, err != nil, nil
+	}
+
+	tasks, err := bp.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, false, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, true, nil
+	}
+	return tasks[0], false, nil
+}
+
+// PushBatch pushes the batch to the primary in one call and spills the tasks
+// it failed to push.
+func (s *FailoverStore) PushBatch(tasks []interfaces.Task) error {
+	tasks = slices.Clone(tasks)
+	for i := range tasks {
+		if tasks[i].ID == "" {
+			tasks[i].ID = uuid.NewString()
+		}
+	}
+
+	s.mu.Lock()
+	direct := !s.spilling && s.allow()
+	s.mu.Unlock()
+
+	var failed []error
+	if direct {
+		failed = interfaces.PushBatch(s.primary, tasks)
+		err := interfaces.NewBatchError(failed)
+		s.record(err)
+		if err == nil {
+			return nil
+		}
+		log.Printf("⚠️ Falha ao enviar lote ao store primário, usando fallback: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spilling = true
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	for i, task := range tasks {
+		if failed != nil && failed[i] == nil {
+			continue
+		}
+		if err := s.spill(task); err != nil {
+			result.Errors[i] = fmt.Errorf("failed to push task to fallback: %w", err)
+		}
+	}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *FailoverStore) Pop() (interfaces.Task, error) {
+	return s.primary.Pop()
+}
+
+func (s *FailoverStore) Ack(task interfaces.Task) error {
+	return s.primary.Ack(task)
+}
+
+func (s *FailoverStore) Nack(task interfaces.Task, delay time.Duration) error {
+	return s.primary.Nack(task, delay)
+}
+
+func (s *FailoverStore) PopBatch(max int) ([]interfaces.Task, error) {
+	return interfaces.PopBatch(s.primary, max)
+}
+
+func (s *FailoverStore) AckBatch(tasks []interfaces.Task) error {
+	return interfaces.NewBatchError(interfaces.AckBatch(s.primary, tasks))
+}
+
+func (s *FailoverStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	return extendLease(s.primary, task, lease)
+}
+
+// SetPaused uses the primary when it is a PauseStore, and memory otherwise.
+func (s *FailoverStore) SetPaused(name string, paused bool) error {
+	if ps, ok := s.primary.(interfaces.PauseStore); ok {
+		return ps.SetPaused(name, paused)
+	}
+	return s.paused.SetPaused(name, paused)
+}
+
+func (s *FailoverStore) PausedNames() ([]string, error) {
+	if ps, ok := s.primary.(interfaces.PauseStore); ok {
+		return ps.PausedNames()
+	}
+	return s.paused.PausedNames()
+}
@@ -0,0 +1,610 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/gofrs/flock"
+	"github.com/google/uuid"
+)
+
+const (
+	walFile      = "wal"
+	snapshotFile = "snapshot"
+	lockFile     = "LOCK"
+	headerSize   = 8
+)
+
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs the WAL before every write returns.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncInterval syncs the WAL in the background, losing at most the
+	// last interval of writes on a machine crash.
+	FsyncInterval
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever
+)
+
+const (
+	opPush    = "push"
+	opPop     = "pop"
+	opAck     = "ack"
+	opNack    = "nack"
+	opRecover = "recover"
+	opPause   = "pause"
+	opResume  = "resume"
+	opLSN     = "snapshot"
+)
+
+type walRecord struct {
+	LSN         uint64           `json:"lsn"`
+	Op          string           `json:"op"`
+	Task        *interfaces.Task `json:"task,omitempty"`
+	ID          string           `json:"id,omitempty"`
+	ScheduledAt *time.Time       `json:"scheduled_at,omitempty"`
+	Name        string           `json:"name,omitempty"`
+}
+
+// FileStore is an embedded store that keeps its state in memory and appends
+// every change to a write-ahead log in dir. The log is compacted into a
+// snapshot once it grows past the compaction threshold. On open, the snapshot
+// and the log are replayed and tasks that were pending when the process
+// stopped become ready again. A lock file keeps other processes out of dir.
+type FileStore struct {
+	dir          string
+	lock         *flock.Flock
+	policy       FsyncPolicy
+	interval     time.Duration
+	compactAfter int
+
+	mu      sync.Mutex
+	wal     *os.File
+	size    int64
+	lsn     uint64
+	records int
+	dirty   bool
+	closed  bool
+	queue   []interfaces.Task
+	pending []interfaces.Task
+	paused  map[string]bool
+	groups  map[string]bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type FileOption func(*FileStore)
+
+// WithFsync sets when the WAL is synced to disk. The interval is only used by
+// FsyncInterval. Defaults to FsyncAlways.
+func WithFsync(policy FsyncPolicy, interval time.Duration) FileOption {
+	return func(s *FileStore) {
+		s.policy = policy
+		s.interval = interval
+	}
+}
+
+// WithCompaction compacts the WAL into a snapshot every records writes.
+// Defaults to 10000; zero disables automatic compaction.
+func WithCompaction(records int) FileOption {
+	return func(s *FileStore) {
+		s.compactAfter = records
+	}
+}
+
+func NewFileStore(dir string, opts ...FileOption) (*FileStore, error) {
+	s := &FileStore{
+		dir:          dir,
+		policy:       FsyncAlways,
+		interval:     time.Second,
+		compactAfter: 10000,
+		paused:       make(map[string]bool),
+		groups:       make(map[string]bool),
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	s.lock = flock.New(filepath.Join(dir, lockFile))
+	locked, err := s.lock.TryLock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock directory: %w", err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("directory %s is in use by another process", dir)
+	}
+
+	if err := s.open(); err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+
+	if s.policy == FsyncInterval && s.interval > 0 {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+func (s *FileStore) open() error {
+	var snapshotLSN uint64
+	if f, err := os.Open(filepath.Join(s.dir, snapshotFile)); err == nil {
+		_, err := readRecords(f, func(rec walRecord) {
+			if rec.Op == opLSN {
+				snapshotLSN = rec.LSN
+			}
+			s.apply(rec)
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	s.lsn = snapshotLSN
+
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open wal: %w", err)
+	}
+
+	valid, err := readRecords(wal, func(rec walRecord) {
+		if rec.LSN > snapshotLSN {
+			s.apply(rec)
+			s.lsn = rec.LSN
+			s.records++
+		}
+	})
+	if err != nil {
+		// A torn write at the end of the log is dropped.
+		if err := wal.Truncate(valid); err != nil {
+			wal.Close()
+			return fmt.Errorf("failed to truncate wal: %w", err)
+		}
+	}
+	if _, err := wal.Seek(valid, io.SeekStart); err != nil {
+		wal.Close()
+		return fmt.Errorf("failed to seek wal: %w", err)
+	}
+	s.wal = wal
+	s.size = valid
+
+	if len(s.pending) > 0 {
+		return s.write(walRecord{Op: opRecover})
+	}
+	return nil
+}
+
+// readRecords calls fn for every complete record and returns the offset
+// after the last one.
+func readRecords(r io.Reader, fn func(walRecord)) (int64, error) {
+	var offset int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, err
+		}
+
+		data := make([]byte, binary.LittleEndian.Uint32(header[:4]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return offset, err
+		}
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(header[4:]) {
+			return offset, errors.New("checksum mismatch")
+		}
+
+		var rec walRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return offset, err
+		}
+		fn(rec)
+		offset += int64(headerSize + len(data))
+	}
+}
+
+func encodeRecord(rec walRecord) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal record: %w", err)
+	}
+	buf := make([]byte, headerSize, headerSize+len(data))
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(data))
+	return append(buf, data...), nil
+}
+
+// write appends the records to the WAL and then applies them. Must be called
+// with s.mu held.
+func (s *FileStore) write(recs ...walRecord) error {
+	if s.closed {
+		return errors.New("file store is closed")
+	}
+	if len(recs) == 0 {
+		return nil
+	}
+
+	var buf []byte
+	for i := range recs {
+		recs[i].LSN = s.lsn + uint64(i) + 1
+		data, err := encodeRecord(recs[i])
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+	}
+
+	if _, err := s.wal.Write(buf); err != nil {
+		s.rollback()
+		return fmt.Errorf("failed to write wal: %w", err)
+	}
+	if s.policy == FsyncAlways {
+		if err := s.wal.Sync(); err != nil {
+			s.rollback()
+			return fmt.Errorf("failed to sync wal: %w", err)
+		}
+	} else {
+		s.dirty = true
+	}
+	s.size += int64(len(buf))
+
+	for _, rec := range recs {
+		s.apply(rec)
+	}
+	s.lsn += uint64(len(recs))
+	s.records += len(recs)
+
+	// The records are durable and applied, so a failed compaction must not
+	// fail the operation; the next write tries again.
+	if s.compactAfter > 0 && s.records >= s.compactAfter {
+		if err := s.compact(); err != nil {
+			log.Printf("⚠️ Falha ao compactar o WAL: %v", err)
+		}
+	}
+	return nil
+}
+
+// rollback truncates the WAL back to before a failed append, so records the
+// caller was told failed are not replayed on restart.
+func (s *FileStore) rollback() {
+	if err := s.wal.Truncate(s.size); err != nil {
+		log.Printf("⚠️ Falha ao descartar escrita incompleta do WAL: %v", err)
+	}
+	s.wal.Seek(s.size, io.SeekStart)
+}
+
+func (s *FileStore) apply(rec walRecord) {
+	switch rec.Op {
+	case opPush:
+		s.queue = append(s.queue, *rec.Task)
+	case opPop:
+		if i := indexOf(s.queue, rec.ID); i >= 0 {
+			task := s.queue[i]
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.pending = append(s.pending, task)
+			if task.GroupKey != "" {
+				s.groups[task.GroupKey] = true
+			}
+		}
+	case opAck:
+		if i := indexOf(s.pending, rec.ID); i >= 0 {
+			delete(s.groups, s.pending[i].GroupKey)
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+		}
+	case opNack:
+		if i := indexOf(s.pending, rec.ID); i >= 0 {
+			task := s.pending[i]
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			if rec.ScheduledAt != nil {
+				task.ScheduledAt = *rec.ScheduledAt
+			}
+			if task.GroupKey != "" {
+				delete(s.groups, task.GroupKey)
+				s.queue = append([]interfaces.Task{task}, s.queue...)
+			} else {
+				s.queue = append(s.queue, task)
+			}
+		}
+	case opRecover:
+		s.queue = append(s.pending, s.queue...)
+		s.pending = nil
+		clear(s.groups)
+	case opPause:
+		s.paused[rec.Name] = true
+	case opResume:
+		delete(s.paused, rec.Name)
+	}
+}
+
+func indexOf(tasks []interfaces.Task, id string) int {
+	for i, t := range tasks {
+		if t.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Compact writes the current state to a new snapshot and truncates the WAL.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("file store is closed")
+	}
+	return s.compact()
+}
+
+func (s *FileStore) compact() error {
+	recs := []walRecord{{LSN: s.lsn, Op: opLSN}}
+	for _, task := range append(append([]interfaces.Task{}, s.pending...), s.queue...) {
+		recs = append(recs, walRecord{Op: opPush, Task: &task})
+	}
+	for _, task := range s.pending {
+		recs = append(recs, walRecord{Op: opPop, ID: task.ID})
+	}
+	for name := range s.paused {
+		recs = append(recs, walRecord{Op: opPause, Name: name})
+	}
+
+	var buf []byte
+	for _, rec := range recs {
+		data, err := encodeRecord(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, data...)
+	}
+
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	if err := writeFileSync(tmp, buf); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+
+	// Records up to the snapshot LSN are skipped on replay, so a crash
+	// before the truncation is harmless.
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate wal: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek wal: %w", err)
+	}
+	s.size = 0
+	s.records = 0
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *FileStore) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if s.dirty && !s.closed {
+			if err := s.wal.Sync(); err == nil {
+				s.dirty = false
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Close syncs the WAL and releases the directory lock.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stop)
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	errs := []error{s.wal.Sync(), s.wal.Close(), s.lock.Unlock()}
+	return errors.Join(errs...)
+}
+
+func (s *FileStore) Push(task interfaces.Task) error {
+	return s.PushBatch([]interfaces.Task{task})
+}
+
+// PushBatch writes the whole batch with a single WAL append.
+func (s *FileStore) PushBatch(tasks []interfaces.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs := make([]walRecord, len(tasks))
+	for i, task := range tasks {
+		if task.ID == "" {
+			task.ID = uuid.NewString()
+		}
+		recs[i] = walRecord{Op: opPush, Task: &task}
+	}
+	return s.write(recs...)
+}
+
+func (s *FileStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no task ready")
+	}
+	return tasks[0], nil
+}
+
+// PopBatch hands out the oldest ready tasks, skipping grouped tasks the same
+// way MemoryStore does.
+func (s *FileStore) PopBatch(max int) ([]interfaces.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	blocked := make(map[string]bool)
+
+	var tasks []interfaces.Task
+	var recs []walRecord
+	for _, task := range s.queue {
+		if len(tasks) >= max {
+			break
+		}
+
+		group := task.GroupKey
+		if group != "" && (s.groups[group] || blocked[group]) {
+			continue
+		}
+		if group != "" {
+			blocked[group] = true
+		}
+		if task.ScheduledAt.After(now) {
+			continue
+		}
+
+		tasks = append(tasks, task)
+		recs = append(recs, walRecord{Op: opPop, ID: task.ID})
+	}
+
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	if err := s.write(recs...); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (s *FileStore) Ack(task interfaces.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if indexOf(s.pending, task.ID) < 0 {
+		return errors.New("task not found in pending")
+	}
+	return s.write(walRecord{Op: opAck, ID: task.ID})
+}
+
+func (s *FileStore) AckBatch(tasks []interfaces.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	var recs []walRecord
+	for i, task := range tasks {
+		if indexOf(s.pending, task.ID) < 0 {
+			result.Errors[i] = errors.New("task not found in pending")
+			continue
+		}
+		recs = append(recs, walRecord{Op: opAck, ID: task.ID})
+	}
+
+	if err := s.write(recs...); err != nil {
+		for i := range result.Errors {
+			if result.Errors[i] == nil {
+				result.Errors[i] = err
+			}
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *FileStore) Nack(task interfaces.Task, delay time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if indexOf(s.pending, task.ID) < 0 {
+		return errors.New("task not found in pending")
+	}
+
+	rec := walRecord{Op: opNack, ID: task.ID}
+	if delay > 0 {
+		at := time.Now().Add(delay)
+		rec.ScheduledAt = &at
+	}
+	return s.write(rec)
+}
+
+func (s *FileStore) SetPaused(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if paused {
+		return s.write(walRecord{Op: opPause, Name: name})
+	}
+	return s.write(walRecord{Op: opResume, Name: name})
+}
+
+func (s *FileStore) PausedNames() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.paused))
+	for name := range s.paused {
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+)
+
+// extendLease and pauseSet let stores wrapping other stores offer the optional
+// interfaces whether or not the wrapped store implements them, as
+// interfaces.PushBatch, PopBatch and AckBatch do for batches.
+
+// extendLease is a no-op for stores without leases: they keep a popped task
+// until it is acked or nacked.
+func extendLease(s interfaces.TaskStore, task interfaces.Task, lease time.Duration) error {
+	if le, ok := s.(interfaces.LeaseExtender); ok {
+		return le.ExtendLease(task, lease)
+	}
+	return nil
+}
+
+// pauseSet keeps paused task names in memory for wrappers whose stores do not
+// persist them.
+type pauseSet struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (p *pauseSet) SetPaused(name string, paused bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.names == nil {
+		p.names = make(map[string]bool)
+	}
+	if paused {
+		p.names[name] = true
+	} else {
+		delete(p.names, name)
+	}
+	return nil
+}
+
+func (p *pauseSet) PausedNames() ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.names))
+	for name := range p.names {
+		names = append(names, name)
+	}
+	return names, nil
+}
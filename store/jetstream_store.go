@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// JetStreamPublisher is the subset of jetstream.JetStream used to publish.
+type JetStreamPublisher interface {
+	Publish(ctx context.Context, subject string, payload []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error)
+}
+
+// JetStreamConsumer is the subset of jetstream.Consumer used to fetch.
+type JetStreamConsumer interface {
+	FetchNoWait(batch int) (jetstream.MessageBatch, error)
+}
+
+// JetStreamStore publishes tasks to a subject and pulls them through a
+// durable consumer. Ack maps to Ack, Nack to Nak or NakWithDelay and
+// ExtendLease to InProgress. Tasks fetched before their ScheduledAt are nacked
+// with the remaining delay, and messages that cannot be decoded are terminated.
+// Fetched messages are kept in memory until they are settled or their AckWait
+// expires, keyed by Task.ReceiptHandle; once it expires the message may have
+// been redelivered elsewhere, so its task can no longer be settled here.
+type JetStreamStore struct {
+	js       JetStreamPublisher
+	consumer JetStreamConsumer
+	subject  string
+	ackWait  time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]jetStreamEntry
+}
+
+type jetStreamEntry struct {
+	msg     jetstream.Msg
+	expires time.Time
+}
+
+type JetStreamOption func(*JetStreamStore)
+
+// WithJetStreamAckWait sets the consumer's AckWait, after which a fetched
+// message is dropped from memory. Defaults to 30 seconds, the JetStream
+// default.
+func WithJetStreamAckWait(d time.Duration) JetStreamOption {
+	return func(s *JetStreamStore) {
+		s.ackWait = d
+	}
+}
+
+func NewJetStreamStore(js JetStreamPublisher, consumer JetStreamConsumer, subject string, opts ...JetStreamOption) *JetStreamStore {
+	s := &JetStreamStore{
+		js:       js,
+		consumer: consumer,
+		subject:  subject,
+		ackWait:  30 * time.Second,
+		inflight: make(map[string]jetStreamEntry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewDurableJetStreamStore creates or updates the durable pull consumer on
+// stream and returns a store using it. Messages not acked within ackWait are
+// redelivered.
+func NewDurableJetStreamStore(ctx context.Context, js jetstream.JetStream, stream, subject, durable string, ackWait time.Duration) (*JetStreamStore, error) {
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxDeliver:    -1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+	return NewJetStreamStore(js, consumer, subject, WithJetStreamAckWait(ackWait)), nil
+}
+
+// Push publishes the task with its UniqueKey, or its ID, as the message ID so
+// the stream drops duplicates inside its deduplication window.
+func (s *JetStreamStore) Push(task interfaces.Task) error {
+	if task.ID == "" {
+		task.ID = uuid.NewString()
+	}
+	task.ReceiptHandle = ""
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	msgID := task.UniqueKey
+	if msgID == "" {
+		msgID = task.ID
+	}
+
+	if _, err := s.js.Publish(context.Background(), s.subject, data, jetstream.WithMsgID(msgID)); err != nil {
+		return fmt.Errorf("failed to publish task: %w", err)
+	}
+	return nil
+}
+
+func (s *JetStreamStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
+
+func (s *JetStreamStore) PopBatch(max int) ([]interfaces.Task, error) {
+	batch, err := s.consumer.FetchNoWait(max)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tasks: %w", err)
+	}
+
+	s.expire()
+
+	// A bad message is logged and skipped, so the rest of the fetched batch
+	// is still handed out.
+	var tasks []interfaces.Task
+	for msg := range batch.Messages() {
+		var task interfaces.Task
+		if err := json.Unmarshal(msg.Data(), &task); err != nil {
+			log.Printf("⚠️ Mensagem %s do JetStream inválida descartada: %v", receiptHandle(msg), err)
+			if err := msg.Term(); err != nil {
+				log.Printf("⚠️ Falha ao descartar a mensagem %s do JetStream: %v", receiptHandle(msg), err)
+			}
+			continue
+		}
+
+		if task.ScheduledAt.After(time.Now()) {
+			if err := msg.NakWithDelay(time.Until(task.ScheduledAt)); err != nil {
+				log.Printf("⚠️ Falha ao adiar a task %s: %v", task.ID, err)
+			}
+			continue
+		}
+
+		task.ReceiptHandle = receiptHandle(msg)
+		s.mu.Lock()
+		s.inflight[task.ReceiptHandle] = jetStreamEntry{msg: msg, expires: time.Now().Add(s.ackWait)}
+		s.mu.Unlock()
+		tasks = append(tasks, task)
+	}
+
+	if err := batch.Error(); err != nil && !errors.Is(err, jetstream.ErrNoMessages) {
+		return tasks, fmt.Errorf("failed to fetch tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func receiptHandle(msg jetstream.Msg) string {
+	if meta, err := msg.Metadata(); err == nil {
+		return strconv.FormatUint(meta.Sequence.Stream, 10)
+	}
+	return uuid.NewString()
+}
+
+// expire drops the messages whose AckWait has passed.
+func (s *JetStreamStore) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for handle, entry := range s.inflight {
+		if now.After(entry.expires) {
+			delete(s.inflight, handle)
+		}
+	}
+}
+
+// message returns the fetched message of task. Unless it is removed, its
+// AckWait starts over, as ExtendLease resets it on the server.
+func (s *JetStreamStore) message(task interfaces.Task, remove bool) (jetstream.Msg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.inflight[task.ReceiptHandle]
+	if !ok || time.Now().After(entry.expires) {
+		delete(s.inflight, task.ReceiptHandle)
+		return nil, errors.New("task not found in pending")
+	}
+	if remove {
+		delete(s.inflight, task.ReceiptHandle)
+	} else {
+		entry.expires = time.Now().Add(s.ackWait)
+		s.inflight[task.ReceiptHandle] = entry
+	}
+	return entry.msg, nil
+}
+
+func (s *JetStreamStore) Ack(task interfaces.Task) error {
+	msg, err := s.message(task, true)
+	if err != nil {
+		return err
+	}
+	if err := msg.Ack(); err != nil {
+		return fmt.Errorf("failed to ack task: %w", err)
+	}
+	return nil
+}
+
+func (s *JetStreamStore) Nack(task interfaces.Task, delay time.Duration) error {
+	msg, err := s.message(task, true)
+	if err != nil {
+		return err
+	}
+
+	if delay > 0 {
+		err = msg.NakWithDelay(delay)
+	} else {
+		err = msg.Nak()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to nack task: %w", err)
+	}
+	return nil
+}
+
+// ExtendLease resets the consumer's AckWait for the message. The lease length
+// is fixed by the consumer, so the argument is ignored.
+func (s *JetStreamStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	msg, err := s.message(task, false)
+	if err != nil {
+		return err
+	}
+	if err := msg.InProgress(); err != nil {
+		return fmt.Errorf("failed to extend lease: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,499 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+)
+
+// KafkaMessage is a record read from or written to a topic. Partition and
+// Offset are set on fetched records.
+type KafkaMessage struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// KafkaProducer writes records, waiting until the broker acknowledged them.
+type KafkaProducer interface {
+	Produce(ctx context.Context, msgs ...KafkaMessage) error
+}
+
+// KafkaConsumer reads records as a member of a consumer group. Fetch blocks
+// until a record is available. Commit stores, for each record's partition,
+// the record's offset plus one as the group's position.
+type KafkaConsumer interface {
+	Fetch(ctx context.Context) (KafkaMessage, error)
+	Commit(ctx context.Context, msgs ...KafkaMessage) error
+}
+
+// KafkaRevoker is implemented by consumers that report partitions taken away
+// by a rebalance, as topic to partitions. NewKafkaStore registers a callback
+// that drops the state of those partitions.
+type KafkaRevoker interface {
+	OnRevoke(fn func(revoked map[string][]int))
+}
+
+// KafkaStore produces tasks to a topic keyed by GroupKey and consumes them
+// through a consumer group subscribed to the topic and its retry topic.
+// Offsets are committed only up to the last record of each partition whose
+// task and all earlier ones were acked, so a restart never skips an
+// unfinished task. Scheduled and delayed tasks are produced to the retry topic
+// and held in memory until due. A grouped task is not handed out while an
+// earlier task of its group is pending. DeadLetter produces a task to the dead
+// topic and settles its record.
+type KafkaStore struct {
+	producer   KafkaProducer
+	consumer   KafkaConsumer
+	topic      string
+	retryTopic string
+	deadTopic  string
+	buffer     int
+
+	mu         sync.Mutex
+	ready      []kafkaEntry
+	delayed    []kafkaEntry
+	inflight   map[string]kafkaEntry
+	groups     map[string]string
+	partitions map[kafkaPartition]*kafkaOffsets
+
+	commitMu sync.Mutex
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type KafkaOption func(*KafkaStore)
+
+// WithKafkaRetryTopic sets the topic used for delayed tasks. Defaults to
+// "<topic>.retry".
+func WithKafkaRetryTopic(topic string) KafkaOption {
+	return func(s *KafkaStore) {
+		s.retryTopic = topic
+	}
+}
+
+// WithKafkaDeadTopic sets the topic DeadLetter produces to. Defaults to
+// "<topic>.dead".
+func WithKafkaDeadTopic(topic string) KafkaOption {
+	return func(s *KafkaStore) {
+		s.deadTopic = topic
+	}
+}
+
+// WithKafkaBuffer sets how many fetched tasks, waiting or pending, the store
+// holds before it stops fetching. Tasks delayed until later are not counted, so
+// they never hold back tasks that are ready. Defaults to 100.
+func WithKafkaBuffer(n int) KafkaOption {
+	return func(s *KafkaStore) {
+		s.buffer = max(n, 1)
+	}
+}
+
+type kafkaEntry struct {
+	task interfaces.Task
+	msg  KafkaMessage
+}
+
+type kafkaPartition struct {
+	topic     string
+	partition int
+}
+
+// kafkaOffsets tracks the fetched offsets of a partition that were not
+// committed yet, in fetch order.
+type kafkaOffsets struct {
+	offsets []int64
+	done    map[int64]bool
+}
+
+// NewKafkaStore starts fetching from consumer, which must be subscribed to
+// topic and the retry topic. Call Close to stop it. If consumer is a
+// KafkaRevoker, the state of revoked partitions is dropped on rebalance.
+func NewKafkaStore(producer KafkaProducer, consumer KafkaConsumer, topic string, opts ...KafkaOption) *KafkaStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &KafkaStore{
+		producer:   producer,
+		consumer:   consumer,
+		topic:      topic,
+		retryTopic: topic + ".retry",
+		deadTopic:  topic + ".dead",
+		buffer:     100,
+		inflight:   make(map[string]kafkaEntry),
+		groups:     make(map[string]string),
+		partitions: make(map[kafkaPartition]*kafkaOffsets),
+		wake:       make(chan struct{}, 1),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if r, ok := consumer.(KafkaRevoker); ok {
+		r.OnRevoke(s.revoke)
+	}
+	go s.fetch(ctx)
+	return s
+}
+
+func (s *KafkaStore) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+func (s *KafkaStore) fetch(ctx context.Context) {
+	defer close(s.done)
+
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		full := s.full()
+		s.mu.Unlock()
+
+		if full {
+			select {
+			case <-s.wake:
+			case <-time.After(100 * time.Millisecond):
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		msg, err := s.consumer.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("⚠️ Falha ao ler do Kafka: %v", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		s.add(ctx, msg)
+	}
+}
+
+// full reports whether the buffer is used up. A group whose owner was nacked
+// with a delay stays locked until the retry copy comes back from the retry
+// topic, so fetching goes on past the buffer while such a copy is missing;
+// otherwise tasks queued behind the group could fill it for good. Callers
+// hold s.mu.
+func (s *KafkaStore) full() bool {
+	if len(s.ready)+len(s.inflight) < s.buffer {
+		return false
+	}
+
+	held := s.held()
+	for _, owner := range s.groups {
+		if !held[owner] {
+			return false
+		}
+	}
+	return true
+}
+
+// held returns the IDs of the tasks in memory. Callers hold s.mu.
+func (s *KafkaStore) held() map[string]bool {
+	held := make(map[string]bool, len(s.ready)+len(s.delayed)+len(s.inflight))
+	for _, entries := range [][]kafkaEntry{s.ready, s.delayed} {
+		for _, entry := range entries {
+			held[entry.task.ID] = true
+		}
+	}
+	for _, entry := range s.inflight {
+		held[entry.task.ID] = true
+	}
+	return held
+}
+
+// revoke drops the offsets and records of partitions taken away by a
+// rebalance; their new owner reads them again from the last committed offset,
+// and acks of tasks already popped from them fail. Group locks whose owner is
+// no longer in memory are released too, so the order of a group whose retry
+// copy was not fetched yet is not kept across a rebalance.
+func (s *KafkaStore) revoke(revoked map[string][]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gone := make(map[kafkaPartition]bool)
+	for topic, partitions := range revoked {
+		for _, partition := range partitions {
+			p := kafkaPartition{topic, partition}
+			gone[p] = true
+			delete(s.partitions, p)
+		}
+	}
+	dropped := func(entry kafkaEntry) bool {
+		return gone[kafkaPartition{entry.msg.Topic, entry.msg.Partition}]
+	}
+	s.ready = slices.DeleteFunc(s.ready, dropped)
+	s.delayed = slices.DeleteFunc(s.delayed, dropped)
+	for handle, entry := range s.inflight {
+		if dropped(entry) {
+			delete(s.inflight, handle)
+		}
+	}
+
+	held := s.held()
+	for group, owner := range s.groups {
+		if !held[owner] {
+			delete(s.groups, group)
+		}
+	}
+}
+
+func (s *KafkaStore) add(ctx context.Context, msg KafkaMessage) {
+	s.mu.Lock()
+	p := kafkaPartition{msg.Topic, msg.Partition}
+	offsets, ok := s.partitions[p]
+	if !ok {
+		offsets = &kafkaOffsets{done: make(map[int64]bool)}
+		s.partitions[p] = offsets
+	}
+	offsets.offsets = append(offsets.offsets, msg.Offset)
+
+	var task interfaces.Task
+	if err := json.Unmarshal(msg.Value, &task); err != nil {
+		log.Printf("⚠️ Mensagem inválida em %s/%d@%d descartada: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		if err := s.release(ctx, msg); err != nil {
+			log.Printf("⚠️ Falha ao confirmar offset no Kafka: %v", err)
+		}
+		return
+	}
+
+	task.ReceiptHandle = fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+	entry := kafkaEntry{task: task, msg: msg}
+	if task.ScheduledAt.After(time.Now()) {
+		i, _ := slices.BinarySearchFunc(s.delayed, task.ScheduledAt, func(e kafkaEntry, t time.Time) int {
+			return e.task.ScheduledAt.Compare(t)
+		})
+		s.delayed = slices.Insert(s.delayed, i, entry)
+	} else {
+		s.ready = append(s.ready, entry)
+	}
+	s.mu.Unlock()
+}
+
+// settle marks msg as finished and returns the record to commit, if the
+// partition's committable position moved and it was not revoked. Callers hold
+// s.mu.
+func (s *KafkaStore) settle(msg KafkaMessage) *KafkaMessage {
+	offsets, ok := s.partitions[kafkaPartition{msg.Topic, msg.Partition}]
+	if !ok {
+		// Revoked while the task was being settled.
+		return nil
+	}
+	offsets.done[msg.Offset] = true
+
+	last := int64(-1)
+	for len(offsets.offsets) > 0 && offsets.done[offsets.offsets[0]] {
+		last = offsets.offsets[0]
+		delete(offsets.done, last)
+		offsets.offsets = offsets.offsets[1:]
+	}
+	if last < 0 {
+		return nil
+	}
+	return &KafkaMessage{Topic: msg.Topic, Partition: msg.Partition, Offset: last}
+}
+
+// release settles msg, unlocks s.mu and commits the partition's new
+// position. Commits are serialized so a position never moves backwards.
+func (s *KafkaStore) release(ctx context.Context, msg KafkaMessage) error {
+	commit := s.settle(msg)
+	s.commitMu.Lock()
+	defer s.commitMu.Unlock()
+	s.mu.Unlock()
+
+	if commit == nil {
+		return nil
+	}
+	if err := s.consumer.Commit(ctx, *commit); err != nil {
+		return fmt.Errorf("failed to commit offset: %w", err)
+	}
+	return nil
+}
+
+// Push produces the task to the topic, or to the retry topic when it is
+// scheduled for later.
+func (s *KafkaStore) Push(task interfaces.Task) error {
+	if task.ID == "" {
+		task.ID = uuid.NewString()
+	}
+
+	topic := s.topic
+	if task.ScheduledAt.After(time.Now()) {
+		topic = s.retryTopic
+	}
+	return s.produce(topic, task)
+}
+
+func (s *KafkaStore) produce(topic string, task interfaces.Task) error {
+	task.ReceiptHandle = ""
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	msg := KafkaMessage{Topic: topic, Value: data}
+	if task.GroupKey != "" {
+		msg.Key = []byte(task.GroupKey)
+	}
+	if err := s.producer.Produce(context.Background(), msg); err != nil {
+		return fmt.Errorf("failed to produce task: %w", err)
+	}
+	return nil
+}
+
+func (s *KafkaStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
+
+func (s *KafkaStore) PopBatch(max int) ([]interfaces.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	due := 0
+	for due < len(s.delayed) && !s.delayed[due].task.ScheduledAt.After(now) {
+		due++
+	}
+	s.ready = append(s.ready, s.delayed[:due]...)
+	s.delayed = s.delayed[due:]
+
+	var tasks []interfaces.Task
+	blocked := make(map[string]bool)
+	remaining := s.ready[:0]
+	for _, entry := range s.ready {
+		task := entry.task
+		if len(tasks) == max {
+			remaining = append(remaining, entry)
+			continue
+		}
+		if group := task.GroupKey; group != "" {
+			// The owner is a retried task that keeps its group locked.
+			if owner, ok := s.groups[group]; owner != task.ID && (blocked[group] || ok) {
+				blocked[group] = true
+				remaining = append(remaining, entry)
+				continue
+			}
+			s.groups[group] = task.ID
+		}
+		s.inflight[task.ReceiptHandle] = entry
+		tasks = append(tasks, task)
+	}
+	s.ready = remaining
+
+	if len(tasks) > 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return tasks, nil
+}
+
+// finish removes the task from the pending set. The group stays locked when
+// keep is set. Callers hold s.mu.
+func (s *KafkaStore) finish(task interfaces.Task, keep bool) (kafkaEntry, error) {
+	entry, ok := s.inflight[task.ReceiptHandle]
+	if !ok {
+		return kafkaEntry{}, errors.New("task not found in pending")
+	}
+	delete(s.inflight, task.ReceiptHandle)
+
+	if group := entry.task.GroupKey; group != "" && !keep && s.groups[group] == entry.task.ID {
+		delete(s.groups, group)
+	}
+	return entry, nil
+}
+
+func (s *KafkaStore) Ack(task interfaces.Task) error {
+	s.mu.Lock()
+	entry, err := s.finish(task, false)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	return s.release(context.Background(), entry.msg)
+}
+
+// Nack hands the task out again. With a delay, a copy scheduled for later is
+// produced to the retry topic and the original record is settled; its group
+// stays locked until the copy is acked.
+func (s *KafkaStore) Nack(task interfaces.Task, delay time.Duration) error {
+	s.mu.Lock()
+	entry, err := s.finish(task, delay > 0)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if delay <= 0 {
+		s.ready = append([]kafkaEntry{entry}, s.ready...)
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	retry := entry.task
+	retry.ScheduledAt = time.Now().Add(delay)
+	if err := s.produce(s.retryTopic, retry); err != nil {
+		s.mu.Lock()
+		if group := entry.task.GroupKey; group != "" && s.groups[group] == entry.task.ID {
+			delete(s.groups, group)
+		}
+		s.ready = append([]kafkaEntry{entry}, s.ready...)
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	return s.release(context.Background(), entry.msg)
+}
+
+// DeadLetter produces the task to the dead topic and settles its record. The
+// group stays locked until the produce succeeded; if it fails, the task is
+// handed out again.
+func (s *KafkaStore) DeadLetter(task interfaces.Task) error {
+	s.mu.Lock()
+	entry, err := s.finish(task, true)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	if err := s.produce(s.deadTopic, entry.task); err != nil {
+		s.mu.Lock()
+		s.ready = append([]kafkaEntry{entry}, s.ready...)
+		s.mu.Unlock()
+		return fmt.Errorf("failed to dead-letter task: %w", err)
+	}
+
+	s.mu.Lock()
+	if group := entry.task.GroupKey; group != "" && s.groups[group] == entry.task.ID {
+		delete(s.groups, group)
+	}
+	return s.release(context.Background(), entry.msg)
+}
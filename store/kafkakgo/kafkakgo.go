@@ -0,0 +1,152 @@
+// Package kafkakgo adapts a franz-go client to the KafkaProducer and
+// KafkaConsumer interfaces of store.KafkaStore. It is a separate module so the
+// main module does not depend on a Kafka client.
+package kafkakgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Thauan/gotsk/store"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Client produces and consumes through a franz-go client, which must be a
+// consumer group member with auto-commit disabled.
+type Client struct {
+	client *kgo.Client
+
+	mu      sync.Mutex
+	records []*kgo.Record
+	revoke  func(map[string][]int)
+}
+
+// NewClient creates a franz-go client in group, consuming topic and its
+// "<topic>.retry" topic with auto-commit disabled, and reporting revoked and
+// lost partitions to the store. opts are applied last.
+func NewClient(brokers []string, group, topic string, opts ...kgo.Opt) (*Client, error) {
+	c := &Client{}
+	opts = append([]kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics(topic, topic+".retry"),
+		kgo.DisableAutoCommit(),
+		kgo.OnPartitionsRevoked(c.PartitionsRevoked),
+		kgo.OnPartitionsLost(c.PartitionsRevoked),
+	}, opts...)
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client: %w", err)
+	}
+	c.client = client
+	return c, nil
+}
+
+// New wraps a client created elsewhere. Pass PartitionsRevoked to its
+// kgo.OnPartitionsRevoked and kgo.OnPartitionsLost hooks, or the store keeps
+// the state of partitions it no longer owns after a rebalance.
+func New(client *kgo.Client) *Client {
+	return &Client{client: client}
+}
+
+// OnRevoke implements store.KafkaRevoker.
+func (c *Client) OnRevoke(fn func(map[string][]int)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revoke = fn
+}
+
+// PartitionsRevoked drops the polled records of the revoked partitions and
+// tells the store. It has the signature of the franz-go rebalance hooks.
+func (c *Client) PartitionsRevoked(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	gone := make(map[string][]int, len(revoked))
+	for topic, partitions := range revoked {
+		for _, partition := range partitions {
+			gone[topic] = append(gone[topic], int(partition))
+		}
+	}
+
+	c.mu.Lock()
+	c.records = slices.DeleteFunc(c.records, func(r *kgo.Record) bool {
+		return slices.Contains(gone[r.Topic], int(r.Partition))
+	})
+	revoke := c.revoke
+	c.mu.Unlock()
+
+	if revoke != nil {
+		revoke(gone)
+	}
+}
+
+// Close leaves the group and closes the franz-go client.
+func (c *Client) Close() {
+	c.client.Close()
+}
+
+func (c *Client) Produce(ctx context.Context, msgs ...store.KafkaMessage) error {
+	records := make([]*kgo.Record, len(msgs))
+	for i, msg := range msgs {
+		records[i] = &kgo.Record{Topic: msg.Topic, Key: msg.Key, Value: msg.Value}
+	}
+	return c.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+// Fetch returns the next polled record, polling again once the previous poll
+// is used up. Errors are only returned when a poll brought no records. The
+// lock is not held while polling, since rebalance hooks run during a poll.
+func (c *Client) Fetch(ctx context.Context) (store.KafkaMessage, error) {
+	c.mu.Lock()
+	for len(c.records) == 0 {
+		c.mu.Unlock()
+		fetches := c.client.PollRecords(ctx, 100)
+		if err := ctx.Err(); err != nil {
+			return store.KafkaMessage{}, err
+		}
+		if fetches.IsClientClosed() {
+			return store.KafkaMessage{}, kgo.ErrClientClosed
+		}
+
+		records := fetches.Records()
+		if len(records) == 0 {
+			var errs []error
+			fetches.EachError(func(topic string, partition int32, err error) {
+				errs = append(errs, fmt.Errorf("%s/%d: %w", topic, partition, err))
+			})
+			if err := errors.Join(errs...); err != nil {
+				return store.KafkaMessage{}, err
+			}
+		}
+		c.mu.Lock()
+		c.records = append(c.records, records...)
+	}
+
+	r := c.records[0]
+	c.records = c.records[1:]
+	c.mu.Unlock()
+	return store.KafkaMessage{
+		Topic:     r.Topic,
+		Partition: int(r.Partition),
+		Offset:    r.Offset,
+		Key:       r.Key,
+		Value:     r.Value,
+	}, nil
+}
+
+// Commit commits each record's offset plus one. The leader epoch is not known
+// here, so the broker does not check it.
+func (c *Client) Commit(ctx context.Context, msgs ...store.KafkaMessage) error {
+	records := make([]*kgo.Record, len(msgs))
+	for i, msg := range msgs {
+		records[i] = &kgo.Record{
+			Topic:       msg.Topic,
+			Partition:   int32(msg.Partition),
+			Offset:      msg.Offset,
+			LeaderEpoch: -1,
+		}
+	}
+	return c.client.CommitRecords(ctx, records...)
+}
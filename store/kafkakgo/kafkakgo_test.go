@@ -0,0 +1,125 @@
+package kafkakgo_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/Thauan/gotsk/store/kafkakgo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var _ store.KafkaRevoker = (*kafkakgo.Client)(nil)
+
+func newCluster(t *testing.T) []string {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "tasks", "tasks.retry", "tasks.dead"))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()
+}
+
+func newStore(t *testing.T, brokers []string) (*kafkakgo.Client, *store.KafkaStore) {
+	client, err := kafkakgo.NewClient(brokers, "gotsk-workers", "tasks")
+	require.NoError(t, err)
+	s := store.NewKafkaStore(client, client, "tasks")
+	t.Cleanup(func() {
+		s.Close()
+		client.Close()
+	})
+	return client, s
+}
+
+func pop(t *testing.T, s *store.KafkaStore, n int) []interfaces.Task {
+	t.Helper()
+	var tasks []interfaces.Task
+	require.Eventually(t, func() bool {
+		batch, err := s.PopBatch(n - len(tasks))
+		assert.NoError(t, err)
+		tasks = append(tasks, batch...)
+		return len(tasks) == n
+	}, 10*time.Second, 20*time.Millisecond)
+	return tasks
+}
+
+func ids(tasks []interfaces.Task) []string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func TestKafkaStoreCommitsThroughBroker(t *testing.T) {
+	brokers := newCluster(t)
+
+	client, s := newStore(t, brokers)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-1", Name: "sync", GroupKey: "account-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-2", Name: "sync", GroupKey: "account-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "b-1", Name: "sync", GroupKey: "account-b"}))
+
+	tasks := pop(t, s, 2)
+	assert.ElementsMatch(t, []string{"a-1", "b-1"}, ids(tasks))
+	for _, task := range tasks {
+		assert.NoError(t, s.Ack(task))
+	}
+	// a-2 is handed out but never acked, so a restart redelivers it.
+	assert.Equal(t, "a-2", pop(t, s, 1)[0].ID)
+	s.Close()
+	client.Close()
+
+	_, s = newStore(t, brokers)
+	redelivered := pop(t, s, 1)[0]
+	assert.Equal(t, "a-2", redelivered.ID)
+	assert.NoError(t, s.Nack(redelivered, 200*time.Millisecond))
+	retried := pop(t, s, 1)[0]
+	assert.Equal(t, "a-2", retried.ID)
+	assert.NoError(t, s.DeadLetter(retried))
+
+	dead, err := kgo.NewClient(kgo.SeedBrokers(brokers...), kgo.ConsumeTopics("tasks.dead"))
+	require.NoError(t, err)
+	defer dead.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fetches := dead.PollRecords(ctx, 1)
+	require.NoError(t, fetches.Err())
+	records := fetches.Records()
+	require.Len(t, records, 1)
+	var deadTask interfaces.Task
+	assert.NoError(t, json.Unmarshal(records[0].Value, &deadTask))
+	assert.Equal(t, "a-2", deadTask.ID)
+	assert.Equal(t, []byte("account-a"), records[0].Key)
+}
+
+func TestKafkaStoreDropsRevokedPartitions(t *testing.T) {
+	brokers := newCluster(t)
+
+	_, first := newStore(t, brokers)
+	producer, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	require.NoError(t, err)
+	defer producer.Close()
+	for _, key := range []string{"account-a", "account-b", "account-c", "account-d"} {
+		value, err := json.Marshal(interfaces.Task{ID: key, Name: "sync", GroupKey: key})
+		require.NoError(t, err)
+		require.NoError(t, producer.ProduceSync(context.Background(), &kgo.Record{Topic: "tasks", Key: []byte(key), Value: value}).FirstErr())
+	}
+	popped := pop(t, first, 4)
+
+	// A second member takes over a partition; its tasks are read again from
+	// the committed offset and acking them on the first store fails.
+	_, second := newStore(t, brokers)
+	moved := pop(t, second, 1)
+	var stale []string
+	for _, task := range popped {
+		if first.Ack(task) != nil {
+			stale = append(stale, task.ID)
+		}
+	}
+	assert.NotEmpty(t, stale)
+	assert.Contains(t, stale, moved[0].ID)
+}
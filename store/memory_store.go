@@ -12,6 +12,8 @@ type MemoryStore struct {
 	mu      sync.Mutex
 	queue   []interfaces.Task
 	pending []interfaces.Task
+	paused  map[string]bool
+	groups  map[string]bool
 }
 
 func (m *MemoryStore) LenQueue() int {
@@ -30,6 +32,8 @@ func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
 		queue:   []interfaces.Task{},
 		pending: []interfaces.Task{},
+		paused:  make(map[string]bool),
+		groups:  make(map[string]bool),
 	}
 }
 
@@ -40,36 +44,131 @@ func (s *MemoryStore) Push(task interfaces.Task) error {
 	return nil
 }
 
+func (s *MemoryStore) PushBatch(tasks []interfaces.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, tasks...)
+	return nil
+}
+
+// Pop hands out the oldest ready task. A task with a GroupKey is skipped while
+// another task of its group is pending or an older one is not due yet.
 func (s *MemoryStore) Pop() (interfaces.Task, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now()
+	blocked := make(map[string]bool)
 
 	for i, task := range s.queue {
-		if task.ScheduledAt.IsZero() || !task.ScheduledAt.After(now) {
-			s.queue = append(s.queue[:i], s.queue[i+1:]...)
-			s.pending = append(s.pending, task)
-			return task, nil
+		group := task.GroupKey
+		if group != "" && (s.groups[group] || blocked[group]) {
+			continue
 		}
+		if task.ScheduledAt.After(now) {
+			if group != "" {
+				blocked[group] = true
+			}
+			continue
+		}
+
+		if group != "" {
+			s.groups[group] = true
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		s.pending = append(s.pending, task)
+		return task, nil
 	}
 
 	return interfaces.Task{}, errors.New("no task ready")
 }
 
+// Take moves the queued tasks matching match to pending. Tasks of a group with
+// a pending task are left in place.
+func (s *MemoryStore) Take(match func(interfaces.Task) bool) ([]interfaces.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var taken []interfaces.Task
+	remaining := s.queue[:0]
+	for _, task := range s.queue {
+		if (task.GroupKey != "" && s.groups[task.GroupKey]) || !match(task) {
+			remaining = append(remaining, task)
+			continue
+		}
+		taken = append(taken, task)
+	}
+	s.queue = remaining
+	s.pending = append(s.pending, taken...)
+	return taken, nil
+}
+
 func (s *MemoryStore) Ack(task interfaces.Task) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i, t := range s.pending {
-		if t.Name == task.Name && equalPayload(t.Payload, task.Payload) {
+		if sameTask(t, task) {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			delete(s.groups, t.GroupKey)
+			return nil
+		}
+	}
+	return errors.New("task not found in pending")
+}
+
+// Nack puts a grouped task back in front of the queue so it stays ahead of the
+// rest of its group.
+func (s *MemoryStore) Nack(task interfaces.Task, delay time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.pending {
+		if sameTask(t, task) {
 			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			if delay > 0 {
+				t.ScheduledAt = time.Now().Add(delay)
+			}
+			if t.GroupKey != "" {
+				delete(s.groups, t.GroupKey)
+				s.queue = append([]interfaces.Task{t}, s.queue...)
+			} else {
+				s.queue = append(s.queue, t)
+			}
 			return nil
 		}
 	}
 	return errors.New("task not found in pending")
 }
 
+func (s *MemoryStore) SetPaused(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if paused {
+		s.paused[name] = true
+	} else {
+		delete(s.paused, name)
+	}
+	return nil
+}
+
+func (s *MemoryStore) PausedNames() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.paused))
+	for name := range s.paused {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func sameTask(a, b interfaces.Task) bool {
+	if a.ID != "" || b.ID != "" {
+		return a.ID == b.ID
+	}
+	return a.Name == b.Name && equalPayload(a.Payload, b.Payload)
+}
+
 func equalPayload(a, b interfaces.Payload) bool {
 	if len(a) != len(b) {
 		return false
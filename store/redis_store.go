@@ -5,29 +5,209 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Thauan/gotsk/interfaces"
 	"github.com/redis/go-redis/v9"
 )
 
+// groupScanWindow is how many of the oldest queued tasks a pop looks at when
+// skipping tasks whose group is busy.
+const groupScanWindow = 1000
+
+// popScript promotes due tasks and pops up to ARGV[2] tasks, oldest first.
+// Grouped tasks are skipped while their group holds an unexpired lock in KEYS[4]
+// or an older task of the group was skipped; a popped grouped task locks its
+// group for ARGV[4] milliseconds. Retried grouped tasks in KEYS[5] go back to the
+// head of the queue and unlock their group once due.
+var popScript = redis.NewScript(`
+local function group_of(data)
+	if not string.find(data, '"group_key"', 1, true) then
+		return nil
+	end
+	local group = cjson.decode(data)['group_key']
+	if group == nil or group == '' or group == cjson.null then
+		return nil
+	end
+	return group
+end
+
+local due = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, data in ipairs(due) do
+	redis.call('ZREM', KEYS[3], data)
+	redis.call('RPUSH', KEYS[1], data)
+end
+
+local retried = redis.call('ZRANGEBYSCORE', KEYS[5], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, data in ipairs(retried) do
+	redis.call('ZREM', KEYS[5], data)
+	redis.call('RPUSH', KEYS[1], data)
+	local group = group_of(data)
+	if group then
+		redis.call('ZREM', KEYS[4], group)
+	end
+end
+
+local now = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local window = redis.call('LRANGE', KEYS[1], -tonumber(ARGV[3]), -1)
+local blocked = {}
+local items = {}
+for i = #window, 1, -1 do
+	if #items >= limit then
+		break
+	end
+	local data = window[i]
+	local group = group_of(data)
+	local take = true
+	if group then
+		local locked = redis.call('ZSCORE', KEYS[4], group)
+		if blocked[group] or (locked and tonumber(locked) > now) then
+			take = false
+		else
+			redis.call('ZADD', KEYS[4], now + tonumber(ARGV[4]), group)
+		end
+		blocked[group] = true
+	end
+	if take then
+		redis.call('LREM', KEYS[1], -1, data)
+		redis.call('LPUSH', KEYS[2], data)
+		items[#items + 1] = data
+	end
+end
+return items
+`)
+
+// removePending removes a task from the pending list, by its exact JSON when
+// that still matches or else by its ID, and reports whether it was there.
+const removePending = `
+local function remove_pending(key, data, id)
+	if data ~= '' and redis.call('LREM', key, 1, data) > 0 then
+		return true
+	end
+	for _, item in ipairs(redis.call('LRANGE', key, 0, -1)) do
+		local ok, task = pcall(cjson.decode, item)
+		if ok and type(task) == 'table' and task['id'] == id then
+			redis.call('LREM', key, 1, item)
+			return true
+		end
+	end
+	return false
+end
+`
+
+// ackScript removes tasks from pending and unlocks their groups. ARGV holds
+// the JSON, ID and group of each task; it returns 1 for every task removed and
+// 0 for every task not found.
+var ackScript = redis.NewScript(removePending + `
+local results = {}
+for i = 1, #ARGV, 3 do
+	local removed = remove_pending(KEYS[1], ARGV[i], ARGV[i + 1])
+	if removed and ARGV[i + 2] ~= '' then
+		redis.call('ZREM', KEYS[2], ARGV[i + 2])
+	end
+	results[#results + 1] = removed and 1 or 0
+end
+return results
+`)
+
+// nackScript moves a task from pending back to the queue. Grouped tasks return
+// to the head of the queue; when delayed they wait in KEYS[5] with their group
+// locked until ARGV[5] milliseconds after they are due.
+var nackScript = redis.NewScript(removePending + `
+if not remove_pending(KEYS[1], ARGV[1], ARGV[6]) then
+	return 0
+end
+local delayed = tonumber(ARGV[3]) > 0
+if ARGV[4] ~= '' then
+	if delayed then
+		redis.call('ZADD', KEYS[5], ARGV[3], ARGV[2])
+		redis.call('ZADD', KEYS[4], tonumber(ARGV[3]) + tonumber(ARGV[5]), ARGV[4])
+	else
+		redis.call('RPUSH', KEYS[2], ARGV[2])
+		redis.call('ZREM', KEYS[4], ARGV[4])
+	end
+elseif delayed then
+	redis.call('ZADD', KEYS[3], ARGV[3], ARGV[2])
+else
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
 type RedisStore struct {
-	client     *redis.Client
-	queueKey   string
-	pendingKey string
+	client       redis.UniversalClient
+	queueKey     string
+	pendingKey   string
+	pausedKey    string
+	scheduledKey string
+	groupsKey    string
+	retryKey     string
+	groupLockTTL time.Duration
+}
+
+type RedisOption func(*RedisStore)
+
+// WithGroupLockTTL sets how long a popped grouped task holds its group before
+// the next task of the group may run, in case its worker crashed without an ack
+// or nack. It should exceed the longest run of a task. Prefetched tasks renew
+// it through ExtendLease. Defaults to 5 minutes.
+func WithGroupLockTTL(ttl time.Duration) RedisOption {
+	return func(s *RedisStore) {
+		s.groupLockTTL = ttl
+	}
 }
 
-func NewRedisStore(addr string, password string, db int, baseKey string) *RedisStore {
+// NewRedisStore connects to a single Redis node. Its keys keep the
+// "baseKey:queue" layout of earlier versions, which is not cluster safe.
+func NewRedisStore(addr string, password string, db int, baseKey string, opts ...RedisOption) *RedisStore {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
 		DB:       db,
 	})
 
-	return &RedisStore{
-		client:     rdb,
-		queueKey:   fmt.Sprintf("%s:queue", baseKey),
-		pendingKey: fmt.Sprintf("%s:pending", baseKey),
+	return newRedisStore(rdb, baseKey, opts)
+}
+
+// NewRedisStoreWithClient uses an existing client, such as a *redis.Client,
+// a Sentinel *redis.FailoverClient or a *redis.ClusterClient. Keys are prefixed
+// with the hash tag {baseKey} so every script touches a single cluster slot.
+func NewRedisStoreWithClient(client redis.UniversalClient, baseKey string, opts ...RedisOption) *RedisStore {
+	return newRedisStore(client, hashTag(baseKey), opts)
+}
+
+// NewRedisStoreWithOptions builds the client with redis.NewUniversalClient:
+// a MasterName selects Sentinel, several Addrs select Cluster, and TLS,
+// timeouts and pool settings are passed through.
+func NewRedisStoreWithOptions(opts *redis.UniversalOptions, baseKey string, storeOpts ...RedisOption) *RedisStore {
+	return NewRedisStoreWithClient(redis.NewUniversalClient(opts), baseKey, storeOpts...)
+}
+
+func newRedisStore(client redis.UniversalClient, prefix string, opts []RedisOption) *RedisStore {
+	s := &RedisStore{
+		client:       client,
+		queueKey:     fmt.Sprintf("%s:queue", prefix),
+		pendingKey:   fmt.Sprintf("%s:pending", prefix),
+		pausedKey:    fmt.Sprintf("%s:paused", prefix),
+		scheduledKey: fmt.Sprintf("%s:scheduled", prefix),
+		groupsKey:    fmt.Sprintf("%s:group_locks", prefix),
+		retryKey:     fmt.Sprintf("%s:retry", prefix),
+		groupLockTTL: 5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// hashTag wraps baseKey in braces unless it already carries a hash tag.
+func hashTag(baseKey string) string {
+	if start := strings.Index(baseKey, "{"); start >= 0 && strings.Index(baseKey[start:], "}") > 1 {
+		return baseKey
 	}
+	return "{" + baseKey + "}"
 }
 
 func (s *RedisStore) Push(task interfaces.Task) error {
@@ -35,36 +215,193 @@ func (s *RedisStore) Push(task interfaces.Task) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal task: %w", err)
 	}
-	return s.client.LPush(context.Background(), s.queueKey, data).Err()
+
+	ctx := context.Background()
+	if task.ScheduledAt.After(time.Now()) {
+		return s.client.ZAdd(ctx, s.scheduledKey, redis.Z{
+			Score:  float64(task.ScheduledAt.UnixMilli()),
+			Member: data,
+		}).Err()
+	}
+	return s.client.LPush(ctx, s.queueKey, data).Err()
 }
 
-func (s *RedisStore) Pop() (interfaces.Task, error) {
+func (s *RedisStore) PushBatch(tasks []interfaces.Task) error {
 	ctx := context.Background()
-	data, err := s.client.RPop(ctx, s.queueKey).Result()
-	if err == redis.Nil {
-		return interfaces.Task{}, errors.New("no tasks available")
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	cmds := make([]redis.Cmder, len(tasks))
+
+	now := time.Now()
+	pipe := s.client.Pipeline()
+	for i, task := range tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			result.Errors[i] = fmt.Errorf("failed to marshal task: %w", err)
+			continue
+		}
+
+		if task.ScheduledAt.After(now) {
+			cmds[i] = pipe.ZAdd(ctx, s.scheduledKey, redis.Z{
+				Score:  float64(task.ScheduledAt.UnixMilli()),
+				Member: data,
+			})
+		} else {
+			cmds[i] = pipe.LPush(ctx, s.queueKey, data)
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		for i, cmd := range cmds {
+			if cmd != nil && cmd.Err() != nil {
+				result.Errors[i] = fmt.Errorf("failed to push task: %w", cmd.Err())
+			}
+		}
+	}
+
+	if result.Failed() {
+		return result
 	}
+	return nil
+}
+
+func (s *RedisStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
 	if err != nil {
-		return interfaces.Task{}, fmt.Errorf("failed to pop task: %w", err)
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
 	}
+	return tasks[0], nil
+}
 
-	if err := s.client.LPush(ctx, s.pendingKey, data).Err(); err != nil {
-		return interfaces.Task{}, fmt.Errorf("failed to move to pending: %w", err)
+func (s *RedisStore) PopBatch(max int) ([]interfaces.Task, error) {
+	keys := []string{s.queueKey, s.pendingKey, s.scheduledKey, s.groupsKey, s.retryKey}
+	items, err := popScript.Run(context.Background(), s.client, keys, time.Now().UnixMilli(), max, groupScanWindow, s.groupLockTTL.Milliseconds()).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop task: %w", err)
 	}
 
-	var task interfaces.Task
-	if err := json.Unmarshal([]byte(data), &task); err != nil {
-		return interfaces.Task{}, fmt.Errorf("failed to unmarshal task: %w", err)
+	tasks := make([]interfaces.Task, 0, len(items))
+	for _, data := range items {
+		var task interfaces.Task
+		if err := json.Unmarshal([]byte(data), &task); err != nil {
+			return tasks, fmt.Errorf("failed to unmarshal task: %w", err)
+		}
+		tasks = append(tasks, task)
 	}
 
-	return task, nil
+	return tasks, nil
 }
 
+// Ack removes the task from pending by its ID, so a task whose JSON changed
+// since it was popped is still found.
 func (s *RedisStore) Ack(task interfaces.Task) error {
+	removed, err := s.ack([]interfaces.Task{task})
+	if err != nil {
+		return fmt.Errorf("failed to ack task: %w", err)
+	}
+	if !removed[0] {
+		return errors.New("task not found in pending")
+	}
+	return nil
+}
+
+func (s *RedisStore) AckBatch(tasks []interfaces.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	removed, err := s.ack(tasks)
+	for i := range tasks {
+		switch {
+		case err != nil:
+			result.Errors[i] = fmt.Errorf("failed to ack task: %w", err)
+		case !removed[i]:
+			result.Errors[i] = errors.New("task not found in pending")
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+// ack runs ackScript and reports, for each task, whether it was pending.
+func (s *RedisStore) ack(tasks []interfaces.Task) ([]bool, error) {
+	args := make([]any, 0, 3*len(tasks))
+	for _, task := range tasks {
+		// A task that cannot be marshalled is still found by its ID.
+		data, _ := json.Marshal(task)
+		args = append(args, data, task.ID, task.GroupKey)
+	}
+
+	results, err := ackScript.Run(context.Background(), s.client, []string{s.pendingKey, s.groupsKey}, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]bool, len(tasks))
+	for i := range removed {
+		removed[i] = i < len(results) && results[i] == 1
+	}
+	return removed, nil
+}
+
+func (s *RedisStore) Nack(task interfaces.Task, delay time.Duration) error {
+	original, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task for nack: %w", err)
+	}
+
+	var score int64
+	if delay > 0 {
+		task.ScheduledAt = time.Now().Add(delay)
+		score = task.ScheduledAt.UnixMilli()
+	}
+
 	data, err := json.Marshal(task)
 	if err != nil {
-		return fmt.Errorf("failed to marshal task for ack: %w", err)
+		return fmt.Errorf("failed to marshal task for nack: %w", err)
+	}
+
+	keys := []string{s.pendingKey, s.queueKey, s.scheduledKey, s.groupsKey, s.retryKey}
+	moved, err := nackScript.Run(context.Background(), s.client, keys, original, data, score, task.GroupKey, s.groupLockTTL.Milliseconds(), task.ID).Int()
+	if err != nil {
+		return fmt.Errorf("failed to nack task: %w", err)
+	}
+	if moved == 0 {
+		return errors.New("task not found in pending")
+	}
+	return nil
+}
+
+// ExtendLease renews the lock a pending grouped task holds on its group.
+func (s *RedisStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	if task.GroupKey == "" {
+		return nil
+	}
+	until := time.Now().Add(max(lease, s.groupLockTTL)).UnixMilli()
+	err := s.client.ZAddXX(context.Background(), s.groupsKey, redis.Z{Score: float64(until), Member: task.GroupKey}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to extend group lock: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) SetPaused(name string, paused bool) error {
+	ctx := context.Background()
+	if paused {
+		return s.client.SAdd(ctx, s.pausedKey, name).Err()
 	}
+	return s.client.SRem(ctx, s.pausedKey, name).Err()
+}
 
-	return s.client.LRem(context.Background(), s.pendingKey, 1, data).Err()
+func (s *RedisStore) PausedNames() ([]string, error) {
+	names, err := s.client.SMembers(context.Background(), s.pausedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paused tasks: %w", err)
+	}
+	return names, nil
 }
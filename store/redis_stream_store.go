@@ -0,0 +1,452 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/redis/go-redis/v9"
+)
+
+const streamField = "task"
+
+// promoteStreamScript moves due scheduled tasks into the stream.
+var promoteStreamScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, data in ipairs(due) do
+	redis.call('ZREM', KEYS[2], data)
+	redis.call('XADD', KEYS[1], '*', 'task', data)
+end
+return #due
+`)
+
+// nackStreamScript acks a delivered entry and adds the task again, to the
+// scheduled set when ARGV[3] is a future timestamp.
+var nackStreamScript = redis.NewScript(`
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XDEL', KEYS[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[4])
+else
+	redis.call('XADD', KEYS[1], '*', 'task', ARGV[4])
+end
+return 1
+`)
+
+// trimStreamScript deletes the oldest entries beyond ARGV[1], stopping at the
+// first entry that some group has not read yet or still has pending.
+var trimStreamScript = redis.NewScript(`
+local excess = redis.call('XLEN', KEYS[1]) - tonumber(ARGV[1])
+if excess <= 0 then
+	return 0
+end
+
+local function before(a, b)
+	local ams, aseq = string.match(a, '(%d+)-(%d+)')
+	local bms, bseq = string.match(b, '(%d+)-(%d+)')
+	ams, bms = tonumber(ams), tonumber(bms)
+	return ams < bms or (ams == bms and tonumber(aseq) < tonumber(bseq))
+end
+
+local groups = {}
+for _, info in ipairs(redis.call('XINFO', 'GROUPS', KEYS[1])) do
+	local group = {}
+	for i = 1, #info, 2 do
+		group[info[i]] = info[i + 1]
+	end
+	local pending = redis.call('XPENDING', KEYS[1], group['name'])
+	groups[#groups + 1] = {last = group['last-delivered-id'], first = pending[2]}
+end
+
+local deleted = 0
+for _, entry in ipairs(redis.call('XRANGE', KEYS[1], '-', '+', 'COUNT', excess)) do
+	local id = entry[1]
+	for _, group in ipairs(groups) do
+		if before(group.last, id) or (group.first and not before(id, group.first)) then
+			return deleted
+		end
+	end
+	redis.call('XDEL', KEYS[1], id)
+	deleted = deleted + 1
+end
+return deleted
+`)
+
+// RedisStreamStore keeps tasks in a Redis stream read through a consumer
+// group. Its keys share the hash tag {baseKey}, so it works on Redis Cluster.
+// Popped tasks stay in the consumer's pending entries list until acked;
+// entries idle for longer than the claim timeout are taken over by the next
+// Pop, which recovers tasks of crashed consumers. The stream entry ID is kept
+// in Task.ReceiptHandle.
+type RedisStreamStore struct {
+	client       redis.UniversalClient
+	stream       string
+	scheduledKey string
+	pausedKey    string
+	group        string
+	consumer     string
+	claimIdle    time.Duration
+	maxLen       int64
+
+	mu      sync.Mutex
+	created bool
+}
+
+type RedisStreamOption func(*RedisStreamStore)
+
+// WithConsumerGroup sets the consumer group and the consumer name. The default
+// group is "gotsk" and the default consumer is hostname-pid.
+func WithConsumerGroup(group, consumer string) RedisStreamOption {
+	return func(s *RedisStreamStore) {
+		s.group = group
+		s.consumer = consumer
+	}
+}
+
+// WithClaimIdle sets how long a task may stay pending before another consumer
+// claims it. Defaults to 5 minutes; zero disables claiming.
+func WithClaimIdle(idle time.Duration) RedisStreamOption {
+	return func(s *RedisStreamStore) {
+		s.claimIdle = idle
+	}
+}
+
+// WithMaxLen keeps acked tasks in the stream as history instead of deleting
+// them, trimming the oldest to keep at most maxLen entries. Tasks that are not
+// acked yet are never trimmed, so the stream may hold more.
+func WithMaxLen(maxLen int64) RedisStreamOption {
+	return func(s *RedisStreamStore) {
+		s.maxLen = maxLen
+	}
+}
+
+func NewRedisStreamStore(client redis.UniversalClient, baseKey string, opts ...RedisStreamOption) *RedisStreamStore {
+	hostname, _ := os.Hostname()
+	prefix := hashTag(baseKey)
+	s := &RedisStreamStore{
+		client:       client,
+		stream:       fmt.Sprintf("%s:stream", prefix),
+		scheduledKey: fmt.Sprintf("%s:scheduled", prefix),
+		pausedKey:    fmt.Sprintf("%s:paused", prefix),
+		group:        "gotsk",
+		consumer:     fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		claimIdle:    5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *RedisStreamStore) Push(task interfaces.Task) error {
+	ctx := context.Background()
+	if err := s.add(ctx, s.client, task); err != nil {
+		return fmt.Errorf("failed to push task: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStreamStore) PushBatch(tasks []interfaces.Task) error {
+	ctx := context.Background()
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+
+	pipe := s.client.Pipeline()
+	for i, task := range tasks {
+		result.Errors[i] = s.add(ctx, pipe, task)
+	}
+
+	cmds, err := pipe.Exec(ctx)
+	if err != nil {
+		// Commands are queued in task order, skipping tasks that failed to
+		// marshal.
+		i := 0
+		for _, cmd := range cmds {
+			for result.Errors[i] != nil {
+				i++
+			}
+			if cmd.Err() != nil {
+				result.Errors[i] = fmt.Errorf("failed to push task: %w", cmd.Err())
+			}
+			i++
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *RedisStreamStore) add(ctx context.Context, c redis.Cmdable, task interfaces.Task) error {
+	task.ReceiptHandle = ""
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	if task.ScheduledAt.After(time.Now()) {
+		return c.ZAdd(ctx, s.scheduledKey, redis.Z{
+			Score:  float64(task.ScheduledAt.UnixMilli()),
+			Member: data,
+		}).Err()
+	}
+
+	return c.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		Values: map[string]any{streamField: data},
+	}).Err()
+}
+
+func (s *RedisStreamStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
+
+// PopBatch first claims tasks left idle by other consumers and then reads new
+// entries for the group.
+func (s *RedisStreamStore) PopBatch(max int) ([]interfaces.Task, error) {
+	ctx := context.Background()
+	if err := s.ensureGroup(ctx); err != nil {
+		return nil, err
+	}
+
+	keys := []string{s.stream, s.scheduledKey}
+	if err := promoteStreamScript.Run(ctx, s.client, keys, time.Now().UnixMilli()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to promote scheduled tasks: %w", err)
+	}
+
+	var messages []redis.XMessage
+	if s.claimIdle > 0 {
+		claimed, _, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.stream,
+			Group:    s.group,
+			Consumer: s.consumer,
+			MinIdle:  s.claimIdle,
+			Start:    "0-0",
+			Count:    int64(max),
+		}).Result()
+		if err != nil {
+			return nil, s.readError("failed to claim tasks", err)
+		}
+		messages = claimed
+	}
+
+	if remaining := max - len(messages); remaining > 0 {
+		streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    int64(remaining),
+			Block:    -1,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, s.readError("failed to read tasks", err)
+		}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+	}
+
+	tasks := make([]interfaces.Task, 0, len(messages))
+	for _, msg := range messages {
+		task, err := decodeStreamEntry(msg)
+		if err != nil {
+			// Left pending, the entry would be claimed and fail again on
+			// every pop.
+			log.Printf("⚠️ Entrada %s do stream inválida descartada: %v", msg.ID, err)
+			if err := s.remove(ctx, msg.ID); err != nil {
+				log.Printf("⚠️ Falha ao descartar a entrada %s do stream: %v", msg.ID, err)
+			}
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+func decodeStreamEntry(msg redis.XMessage) (interfaces.Task, error) {
+	data, ok := msg.Values[streamField].(string)
+	if !ok {
+		return interfaces.Task{}, errors.New("entry has no task")
+	}
+
+	var task interfaces.Task
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return interfaces.Task{}, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+	task.ReceiptHandle = msg.ID
+	return task, nil
+}
+
+// remove acks and deletes entries.
+func (s *RedisStreamStore) remove(ctx context.Context, ids ...string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, s.stream, s.group, ids...)
+		pipe.XDel(ctx, s.stream, ids...)
+		return nil
+	})
+	return err
+}
+
+// ack removes acked entries, or with WithMaxLen keeps them and trims the
+// history.
+func (s *RedisStreamStore) ack(ctx context.Context, ids ...string) error {
+	if s.maxLen <= 0 {
+		return s.remove(ctx, ids...)
+	}
+
+	if err := s.client.XAck(ctx, s.stream, s.group, ids...).Err(); err != nil {
+		return err
+	}
+	if err := trimStreamScript.Run(ctx, s.client, []string{s.stream}, s.maxLen).Err(); err != nil {
+		log.Printf("⚠️ Falha ao aparar o stream %s: %v", s.stream, err)
+	}
+	return nil
+}
+
+// ensureGroup creates the stream and the consumer group on first use, reading
+// entries added before the group existed.
+func (s *RedisStreamStore) ensureGroup(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.created {
+		return nil
+	}
+
+	err := s.client.XGroupCreateMkStream(ctx, s.stream, s.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	s.created = true
+	return nil
+}
+
+// readError forgets the consumer group when the stream was deleted, so the
+// next pop creates it again.
+func (s *RedisStreamStore) readError(msg string, err error) error {
+	if strings.HasPrefix(err.Error(), "NOGROUP") {
+		s.mu.Lock()
+		s.created = false
+		s.mu.Unlock()
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func (s *RedisStreamStore) Ack(task interfaces.Task) error {
+	if task.ReceiptHandle == "" {
+		return fmt.Errorf("stream entry ID not found for task ID: %s", task.ID)
+	}
+
+	if err := s.ack(context.Background(), task.ReceiptHandle); err != nil {
+		return fmt.Errorf("failed to ack task: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStreamStore) AckBatch(tasks []interfaces.Task) error {
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+
+	var ids []string
+	for i, task := range tasks {
+		if task.ReceiptHandle == "" {
+			result.Errors[i] = fmt.Errorf("stream entry ID not found for task ID: %s", task.ID)
+			continue
+		}
+		ids = append(ids, task.ReceiptHandle)
+	}
+
+	if len(ids) > 0 {
+		if err := s.ack(context.Background(), ids...); err != nil {
+			for i, task := range tasks {
+				if task.ReceiptHandle != "" {
+					result.Errors[i] = fmt.Errorf("failed to ack task: %w", err)
+				}
+			}
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+// Nack adds the task back to the stream, or to the scheduled set when delayed,
+// and acks the delivered entry.
+func (s *RedisStreamStore) Nack(task interfaces.Task, delay time.Duration) error {
+	if task.ReceiptHandle == "" {
+		return fmt.Errorf("stream entry ID not found for task ID: %s", task.ID)
+	}
+
+	id := task.ReceiptHandle
+	task.ReceiptHandle = ""
+
+	var score int64
+	if delay > 0 {
+		task.ScheduledAt = time.Now().Add(delay)
+		score = task.ScheduledAt.UnixMilli()
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task for nack: %w", err)
+	}
+
+	keys := []string{s.stream, s.scheduledKey}
+	moved, err := nackStreamScript.Run(context.Background(), s.client, keys, s.group, id, score, data).Int()
+	if err != nil {
+		return fmt.Errorf("failed to nack task: %w", err)
+	}
+	if moved == 0 {
+		return errors.New("task not found in pending")
+	}
+	return nil
+}
+
+// ExtendLease resets the idle time of a pending task so it is not claimed by
+// another consumer.
+func (s *RedisStreamStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	err := s.client.XClaimJustID(context.Background(), &redis.XClaimArgs{
+		Stream:   s.stream,
+		Group:    s.group,
+		Consumer: s.consumer,
+		Messages: []string{task.ReceiptHandle},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to extend lease: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStreamStore) SetPaused(name string, paused bool) error {
+	ctx := context.Background()
+	if paused {
+		return s.client.SAdd(ctx, s.pausedKey, name).Err()
+	}
+	return s.client.SRem(ctx, s.pausedKey, name).Err()
+}
+
+func (s *RedisStreamStore) PausedNames() ([]string, error) {
+	names, err := s.client.SMembers(context.Background(), s.pausedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paused tasks: %w", err)
+	}
+	return names, nil
+}
@@ -0,0 +1,588 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+)
+
+// ShardedStore spreads tasks across several stores. Tasks are placed on a
+// consistent hash ring by routing key, or round-robin with WithRoundRobin;
+// grouped tasks are always hashed by GroupKey, so a group stays on one shard.
+// Pop polls the shards in turn, starting one shard further on every call. The
+// shard a task came from is kept in its ReceiptHandle, so Ack and Nack reach
+// the same shard. The optional batch, lease and pause methods are forwarded to
+// the shards that implement them.
+type ShardedStore struct {
+	vnodes     int
+	roundRobin bool
+	routingKey func(interfaces.Task) string
+
+	mu      sync.RWMutex
+	shards  []interfaces.TaskStore
+	initial int
+	ring    []shardPoint
+	pinned  map[string]int
+	// stuck marks an old shard whose tasks could not be taken when a shard
+	// was added, so its groups stay on it: {old, added}.
+	stuck map[[2]int]bool
+
+	groupMu sync.Mutex
+	active  map[string]*shardGroup
+
+	paused pauseSet
+	pushes atomic.Uint64
+	polls  atomic.Uint64
+}
+
+// shardGroup counts the popped, unfinished tasks of a group and the shard they
+// came from.
+type shardGroup struct {
+	shard    int
+	inflight int
+}
+
+type shardPoint struct {
+	hash  uint64
+	shard int
+}
+
+type ShardOption func(*ShardedStore)
+
+// WithRoundRobin spreads tasks without a GroupKey evenly instead of hashing
+// them.
+func WithRoundRobin() ShardOption {
+	return func(s *ShardedStore) {
+		s.roundRobin = true
+	}
+}
+
+// WithRoutingKey sets the key hashed for tasks without a GroupKey. Defaults to
+// the task ID.
+func WithRoutingKey(fn func(interfaces.Task) string) ShardOption {
+	return func(s *ShardedStore) {
+		s.routingKey = fn
+	}
+}
+
+// WithVirtualNodes sets how many points each shard has on the ring. More
+// points spread keys more evenly. Defaults to 64.
+func WithVirtualNodes(n int) ShardOption {
+	return func(s *ShardedStore) {
+		s.vnodes = max(n, 1)
+	}
+}
+
+func NewShardedStore(shards []interfaces.TaskStore, opts ...ShardOption) *ShardedStore {
+	s := &ShardedStore{
+		vnodes:     64,
+		routingKey: func(task interfaces.Task) string { return task.ID },
+		pinned:     make(map[string]int),
+		stuck:      make(map[[2]int]bool),
+		active:     make(map[string]*shardGroup),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, shard := range shards {
+		s.addToRing(shard)
+	}
+	s.initial = len(shards)
+	return s
+}
+
+// hashKey mixes the FNV-1a hash of key with the murmur3 finalizer, since FNV
+// alone maps keys differing only in their last bytes close together.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// addToRing appends shard and its points. Points of existing shards do not
+// move, so only keys taken over by the new shard change owner.
+func (s *ShardedStore) addToRing(shard interfaces.TaskStore) {
+	index := len(s.shards)
+	s.shards = append(s.shards, shard)
+	for v := range s.vnodes {
+		s.ring = append(s.ring, shardPoint{hash: hashKey(fmt.Sprintf("shard-%d-%d", index, v)), shard: index})
+	}
+	slices.SortFunc(s.ring, func(a, b shardPoint) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.shard, b.shard))
+	})
+}
+
+// lookup returns the shard owning key. Must be called with mu held.
+func (s *ShardedStore) lookup(key string) int {
+	return s.lookupAmong(key, len(s.shards))
+}
+
+// lookupAmong returns the shard owning key on the ring of the first n shards.
+// Must be called with mu held.
+func (s *ShardedStore) lookupAmong(key string, n int) int {
+	h := hashKey(key)
+	i, _ := slices.BinarySearchFunc(s.ring, h, func(p shardPoint, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	for k := range len(s.ring) {
+		if p := s.ring[(i+k)%len(s.ring)]; p.shard < n {
+			return p.shard
+		}
+	}
+	return 0
+}
+
+// groupShard returns the shard owning group. A shard added by AddShard only
+// takes a group over from a shard that handed over its queued tasks, a
+// TaskTaker; otherwise the group stays where its tasks are. Must be called
+// with mu held.
+func (s *ShardedStore) groupShard(group string) int {
+	shard := s.lookupAmong(group, max(s.initial, 1))
+	for n := max(s.initial, 1) + 1; n <= len(s.shards); n++ {
+		_, ok := s.shards[shard].(interfaces.TaskTaker)
+		if ok && !s.stuck[[2]int{shard, n - 1}] && s.lookupAmong(group, n) == n-1 {
+			shard = n - 1
+		}
+	}
+	return shard
+}
+
+// route returns the shard a task is pushed to. A pinned group stays on the
+// shard its tasks are on. Must be called with mu held.
+func (s *ShardedStore) route(task interfaces.Task) int {
+	if task.GroupKey != "" {
+		if shard, ok := s.pinned[task.GroupKey]; ok {
+			return shard
+		}
+		return s.groupShard(task.GroupKey)
+	}
+	if s.roundRobin {
+		return int((s.pushes.Add(1) - 1) % uint64(len(s.shards)))
+	}
+	return s.lookup(s.routingKey(task))
+}
+
+func (s *ShardedStore) Push(task interfaces.Task) error {
+	if task.ID == "" {
+		task.ID = uuid.NewString()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.shards) == 0 {
+		return errors.New("no shards configured")
+	}
+	return s.shards[s.route(task)].Push(task)
+}
+
+// Pop tries every shard once, starting from the shard after the one the
+// previous call started from.
+func (s *ShardedStore) Pop() (interfaces.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := len(s.shards)
+	if n == 0 {
+		return interfaces.Task{}, errors.New("no shards configured")
+	}
+	start := int((s.polls.Add(1) - 1) % uint64(n))
+	err := errors.New("no tasks available")
+	for k := range n {
+		i := (start + k) % n
+		var task interfaces.Task
+		task, err = s.shards[i].Pop()
+		if err == nil {
+			return s.popped(i, task), nil
+		}
+	}
+	return interfaces.Task{}, err
+}
+
+// popped tags task with the shard it came from and counts it as in flight.
+// Must be called with mu held.
+func (s *ShardedStore) popped(shard int, task interfaces.Task) interfaces.Task {
+	if group := task.GroupKey; group != "" {
+		s.groupMu.Lock()
+		g, ok := s.active[group]
+		if !ok {
+			g = &shardGroup{shard: shard}
+			s.active[group] = g
+		}
+		g.inflight++
+		s.groupMu.Unlock()
+	}
+	task.ReceiptHandle = strconv.Itoa(shard) + "/" + task.ReceiptHandle
+	return task
+}
+
+// finish counts a popped task as done and reports whether its group is pinned
+// with nothing left in flight. A task nacked with a delay is still due on its
+// shard, so its group stays pinned. Must be called with mu held.
+func (s *ShardedStore) finish(task interfaces.Task, delayed bool) bool {
+	group := task.GroupKey
+	if group == "" {
+		return false
+	}
+
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+	g, ok := s.active[group]
+	if !ok {
+		return false
+	}
+	if g.inflight--; g.inflight > 0 {
+		return false
+	}
+	delete(s.active, group)
+	_, pinned := s.pinned[group]
+	return pinned && !delayed
+}
+
+// unpin routes group by the ring again and moves the tasks it left on its old
+// shard, unless one of them was popped in the meantime.
+func (s *ShardedStore) unpin(group string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shard, ok := s.pinned[group]
+	s.groupMu.Lock()
+	_, active := s.active[group]
+	s.groupMu.Unlock()
+	if !ok || active {
+		return
+	}
+
+	delete(s.pinned, group)
+	moved, ok, err := s.rebalance(shard)
+	if !ok {
+		s.pinned[group] = shard
+	}
+	if err != nil {
+		log.Printf("⚠️ Falha ao mover o grupo %s para o novo shard: %v", group, err)
+	}
+	if moved > 0 {
+		log.Printf("🔀 %d tarefas movidas para o novo shard", moved)
+	}
+}
+
+// shardOf returns the shard a popped task came from and the task as that
+// shard handed it out. Must be called with mu held.
+func (s *ShardedStore) shardOf(task interfaces.Task) (interfaces.TaskStore, interfaces.Task, error) {
+	index, handle, ok := strings.Cut(task.ReceiptHandle, "/")
+	i, err := strconv.Atoi(index)
+	if !ok || err != nil || i < 0 || i >= len(s.shards) {
+		return nil, task, fmt.Errorf("invalid receipt handle for task %s", task.ID)
+	}
+	task.ReceiptHandle = handle
+	return s.shards[i], task, nil
+}
+
+func (s *ShardedStore) Ack(task interfaces.Task) error {
+	return s.settle(task, false, func(shard interfaces.TaskStore, task interfaces.Task) error {
+		return shard.Ack(task)
+	})
+}
+
+func (s *ShardedStore) Nack(task interfaces.Task, delay time.Duration) error {
+	return s.settle(task, delay > 0, func(shard interfaces.TaskStore, task interfaces.Task) error {
+		return shard.Nack(task, delay)
+	})
+}
+
+// settle acks or nacks task on its shard and unpins its group once the group
+// has nothing left in flight.
+func (s *ShardedStore) settle(task interfaces.Task, delayed bool, fn func(interfaces.TaskStore, interfaces.Task) error) error {
+	s.mu.RLock()
+	shard, inner, err := s.shardOf(task)
+	if err == nil {
+		err = fn(shard, inner)
+	}
+	release := err == nil && s.finish(task, delayed)
+	s.mu.RUnlock()
+
+	if release {
+		s.unpin(task.GroupKey)
+	}
+	return err
+}
+
+// PushBatch pushes each shard's part of the batch in one call.
+func (s *ShardedStore) PushBatch(tasks []interfaces.Task) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.shards) == 0 {
+		return errors.New("no shards configured")
+	}
+
+	indexes := make(map[int][]int)
+	batches := make(map[int][]interfaces.Task)
+	for i, task := range tasks {
+		if task.ID == "" {
+			task.ID = uuid.NewString()
+		}
+		shard := s.route(task)
+		indexes[shard] = append(indexes[shard], i)
+		batches[shard] = append(batches[shard], task)
+	}
+
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	for shard, batch := range batches {
+		for j, err := range interfaces.PushBatch(s.shards[shard], batch) {
+			result.Errors[indexes[shard][j]] = err
+		}
+	}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+// PopBatch fills the batch from the shards in turn, starting like Pop.
+func (s *ShardedStore) PopBatch(max int) ([]interfaces.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := len(s.shards)
+	if n == 0 {
+		return nil, errors.New("no shards configured")
+	}
+	start := int((s.polls.Add(1) - 1) % uint64(n))
+	var tasks []interfaces.Task
+	var err error
+	for k := 0; k < n && len(tasks) < max; k++ {
+		i := (start + k) % n
+		var batch []interfaces.Task
+		batch, err = interfaces.PopBatch(s.shards[i], max-len(tasks))
+		for _, task := range batch {
+			tasks = append(tasks, s.popped(i, task))
+		}
+	}
+	if len(tasks) == 0 {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// AckBatch acks each shard's part of the batch in one call.
+func (s *ShardedStore) AckBatch(tasks []interfaces.Task) error {
+	s.mu.RLock()
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	indexes := make(map[interfaces.TaskStore][]int)
+	batches := make(map[interfaces.TaskStore][]interfaces.Task)
+	for i, task := range tasks {
+		shard, inner, err := s.shardOf(task)
+		if err != nil {
+			result.Errors[i] = err
+			continue
+		}
+		indexes[shard] = append(indexes[shard], i)
+		batches[shard] = append(batches[shard], inner)
+	}
+	for shard, batch := range batches {
+		for j, err := range interfaces.AckBatch(shard, batch) {
+			result.Errors[indexes[shard][j]] = err
+		}
+	}
+
+	var released []string
+	for i, task := range tasks {
+		if result.Errors[i] == nil && s.finish(task, false) {
+			released = append(released, task.GroupKey)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, group := range released {
+		s.unpin(group)
+	}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *ShardedStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shard, task, err := s.shardOf(task)
+	if err != nil {
+		return err
+	}
+	return extendLease(shard, task, lease)
+}
+
+// SetPaused updates every shard that is a PauseStore, or memory when none is.
+func (s *ShardedStore) SetPaused(name string, paused bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	persisted := false
+	for _, shard := range s.shards {
+		if ps, ok := shard.(interfaces.PauseStore); ok {
+			if err := ps.SetPaused(name, paused); err != nil {
+				return err
+			}
+			persisted = true
+		}
+	}
+	if !persisted {
+		return s.paused.SetPaused(name, paused)
+	}
+	return nil
+}
+
+// PausedNames merges the names paused on every shard.
+func (s *ShardedStore) PausedNames() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	persisted := false
+	var names []string
+	for _, shard := range s.shards {
+		ps, ok := shard.(interfaces.PauseStore)
+		if !ok {
+			continue
+		}
+		persisted = true
+		shardNames, err := ps.PausedNames()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range shardNames {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if !persisted {
+		return s.paused.PausedNames()
+	}
+	return names, nil
+}
+
+// AddShard adds a shard and moves to it the queued tasks whose key now belongs
+// to it, taking them from old shards that are TaskTakers, so they are not
+// handed out or counted as delivered. Other shards keep their tasks, which Pop
+// still finds, and their groups. A group with a task in flight is pinned to
+// its shard, so its new tasks queue behind the ones still there, and moves once
+// nothing of it is in flight. The write lock is held while tasks are moved, so
+// pushes, pops and acks wait until it is done.
+func (s *ShardedStore) AddShard(shard interfaces.TaskStore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addToRing(shard)
+
+	s.groupMu.Lock()
+	for group, g := range s.active {
+		if _, ok := s.pinned[group]; !ok && s.groupShard(group) != g.shard {
+			s.pinned[group] = g.shard
+		}
+	}
+	s.groupMu.Unlock()
+
+	var errs error
+	moved := 0
+	for i := range len(s.shards) - 1 {
+		n, ok, err := s.rebalance(i)
+		if !ok {
+			s.stuck[[2]int{i, len(s.shards) - 1}] = true
+		}
+		moved += n
+		errs = errors.Join(errs, err)
+	}
+
+	if moved > 0 {
+		log.Printf("🔀 %d tarefas movidas para o novo shard", moved)
+	}
+	return errs
+}
+
+// rebalance moves the queued tasks of shard i that are routed to another
+// shard, if it is a TaskTaker. A group whose task could not be moved stays
+// pinned to shard i. It reports false if the tasks could not be taken at all,
+// so the caller keeps the groups on shard i. Must be called with mu held for
+// writing.
+func (s *ShardedStore) rebalance(i int) (int, bool, error) {
+	old, ok := s.shards[i].(interfaces.TaskTaker)
+	if !ok {
+		return 0, true, nil
+	}
+	target := func(task interfaces.Task) int {
+		if task.GroupKey == "" && s.roundRobin {
+			return i
+		}
+		return s.route(task)
+	}
+
+	tasks, err := old.Take(func(task interfaces.Task) bool {
+		return target(task) != i
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to take tasks from shard %d: %w", i, err)
+	}
+
+	var errs error
+	var kept []interfaces.Task
+	moved := 0
+	for _, task := range tasks {
+		// A group pinned here after an earlier task of it failed to move.
+		to := target(task)
+		if to == i {
+			kept = append(kept, task)
+			continue
+		}
+
+		moving := task
+		moving.ReceiptHandle = ""
+		if err := s.shards[to].Push(moving); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to move task %s: %w", task.ID, err))
+			if task.GroupKey != "" {
+				s.pinned[task.GroupKey] = i
+			}
+			kept = append(kept, task)
+			continue
+		}
+		if err := s.shards[i].Ack(task); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to remove moved task %s: %w", task.ID, err))
+		}
+		moved++
+	}
+
+	// Grouped tasks go back in front of their group, so the last one first.
+	requeue := func(task interfaces.Task) {
+		if err := s.shards[i].Nack(task, 0); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to requeue task %s: %w", task.ID, err))
+		}
+	}
+	for _, task := range kept {
+		if task.GroupKey == "" {
+			requeue(task)
+		}
+	}
+	for _, task := range slices.Backward(kept) {
+		if task.GroupKey != "" {
+			requeue(task)
+		}
+	}
+	return moved, true, errs
+}
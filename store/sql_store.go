@@ -0,0 +1,430 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/google/uuid"
+)
+
+type Dialect int
+
+const (
+	Postgres Dialect = iota
+	SQLite
+)
+
+// Rebind turns ? placeholders into $n for Postgres.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlMigrations are applied in order by Migrate; %[1]s is the table name.
+var sqlMigrations = map[Dialect][]string{
+	Postgres: {
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			seq          BIGSERIAL PRIMARY KEY,
+			id           TEXT NOT NULL UNIQUE,
+			name         TEXT NOT NULL,
+			priority     INTEGER NOT NULL DEFAULT 0,
+			available_at BIGINT NOT NULL,
+			data         TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS %[1]s_available_idx ON %[1]s (available_at);
+		CREATE INDEX IF NOT EXISTS %[1]s_priority_idx ON %[1]s (priority DESC, seq);
+		CREATE TABLE IF NOT EXISTS %[1]s_paused (name TEXT PRIMARY KEY);`,
+		`ALTER TABLE %[1]s ADD COLUMN claim TEXT NOT NULL DEFAULT ''`,
+	},
+	SQLite: {
+		`CREATE TABLE IF NOT EXISTS %[1]s (
+			seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+			id           TEXT NOT NULL UNIQUE,
+			name         TEXT NOT NULL,
+			priority     INTEGER NOT NULL DEFAULT 0,
+			available_at INTEGER NOT NULL,
+			data         TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS %[1]s_available_idx ON %[1]s (available_at);
+		CREATE INDEX IF NOT EXISTS %[1]s_priority_idx ON %[1]s (priority DESC, seq);
+		CREATE TABLE IF NOT EXISTS %[1]s_paused (name TEXT PRIMARY KEY);`,
+		`ALTER TABLE %[1]s ADD COLUMN claim TEXT NOT NULL DEFAULT ''`,
+	},
+}
+
+// SQLStore keeps tasks in a table over database/sql. A task is available once
+// its available_at (in Unix milliseconds) has passed: Push sets it to
+// ScheduledAt and Pop moves it forward by the lease, so tasks of a crashed
+// worker are handed out again when the lease expires. Pop takes the highest
+// priority first and uses FOR UPDATE SKIP LOCKED on Postgres. Every pop stores
+// a new claim token in the row and in the task's ReceiptHandle; Ack, Nack and
+// ExtendLease only touch the row while it still holds that claim, so a worker
+// whose lease expired cannot settle a task handed out again since; they return
+// an error instead.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	lease   time.Duration
+}
+
+type SQLOption func(*SQLStore)
+
+// WithTable sets the table name. Defaults to "gotsk_tasks".
+func WithTable(table string) SQLOption {
+	return func(s *SQLStore) {
+		s.table = table
+	}
+}
+
+// WithLease sets how long a popped task stays hidden before it is handed out
+// again. Defaults to 5 minutes.
+func WithLease(lease time.Duration) SQLOption {
+	return func(s *SQLStore) {
+		s.lease = lease
+	}
+}
+
+func NewSQLStore(db *sql.DB, dialect Dialect, opts ...SQLOption) *SQLStore {
+	s := &SQLStore{
+		db:      db,
+		dialect: dialect,
+		table:   "gotsk_tasks",
+		lease:   5 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Migrate creates or upgrades the schema, recording applied versions in the
+// <table>_migrations table.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	versions := s.table + "_migrations"
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (version INTEGER PRIMARY KEY)`, versions))
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	for i, migration := range sqlMigrations[s.dialect] {
+		version := i + 1
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			var applied int
+			err := tx.QueryRowContext(ctx, s.dialect.Rebind(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE version = ?`, versions)), version).Scan(&applied)
+			if err != nil || applied > 0 {
+				return err
+			}
+
+			for _, stmt := range strings.Split(fmt.Sprintf(migration, s.table), ";") {
+				if strings.TrimSpace(stmt) == "" {
+					continue
+				}
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					return err
+				}
+			}
+
+			_, err = tx.ExecContext(ctx, s.dialect.Rebind(fmt.Sprintf(`INSERT INTO %s (version) VALUES (?)`, versions)), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// EnqueueTx inserts a task inside the caller's transaction, so it is only
+// visible to workers if the transaction commits.
+func (s *SQLStore) EnqueueTx(ctx context.Context, tx *sql.Tx, name string, payload interfaces.Payload, options interfaces.TaskOptions) (interfaces.Task, error) {
+	task := interfaces.Task{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Payload:     payload,
+		Priority:    options.Priority,
+		ScheduledAt: options.ScheduledAt,
+		GroupKey:    options.GroupKey,
+		UniqueKey:   options.UniqueKey,
+	}
+	if err := s.insert(ctx, tx, task); err != nil {
+		return interfaces.Task{}, err
+	}
+	return task, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (s *SQLStore) insert(ctx context.Context, db execer, task interfaces.Task) error {
+	if task.ID == "" {
+		task.ID = uuid.NewString()
+	}
+	task.ReceiptHandle = ""
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal task: %w", err)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (id, name, priority, available_at, data) VALUES (?, ?, ?, ?, ?)`, s.table)
+	_, err = db.ExecContext(ctx, s.dialect.Rebind(query), task.ID, task.Name, task.Priority, task.ScheduledAt.UnixMilli(), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to insert task: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Push(task interfaces.Task) error {
+	return s.insert(context.Background(), s.db, task)
+}
+
+// PushBatch inserts the whole batch in one transaction.
+func (s *SQLStore) PushBatch(tasks []interfaces.Task) error {
+	ctx := context.Background()
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for i, task := range tasks {
+			if err := s.insert(ctx, tx, task); err != nil {
+				result.Errors[i] = err
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range result.Errors {
+			if result.Errors[i] == nil {
+				result.Errors[i] = fmt.Errorf("batch rolled back: %w", err)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func (s *SQLStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
+		return interfaces.Task{}, err
+	}
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
+
+func (s *SQLStore) PopBatch(max int) ([]interfaces.Task, error) {
+	now := time.Now()
+
+	lock := ""
+	if s.dialect == Postgres {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	claim := uuid.NewString()
+	query := fmt.Sprintf(`UPDATE %[1]s SET available_at = ?, claim = ?
+		WHERE seq IN (SELECT seq FROM %[1]s WHERE available_at <= ? ORDER BY priority DESC, seq LIMIT ?%[2]s)
+		RETURNING seq, priority, data`, s.table, lock)
+
+	rows, err := s.db.QueryContext(context.Background(), s.dialect.Rebind(query), now.Add(s.lease).UnixMilli(), claim, now.UnixMilli(), max)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pop task: %w", err)
+	}
+	defer rows.Close()
+
+	type popped struct {
+		seq      int64
+		priority int
+		task     interfaces.Task
+	}
+
+	var items []popped
+	for rows.Next() {
+		var item popped
+		var data string
+		if err := rows.Scan(&item.seq, &item.priority, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan task: %w", err)
+		}
+		if err := json.Unmarshal([]byte(data), &item.task); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal task: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to pop task: %w", err)
+	}
+
+	// RETURNING does not keep the subquery order.
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].priority != items[j].priority {
+			return items[i].priority > items[j].priority
+		}
+		return items[i].seq < items[j].seq
+	})
+
+	tasks := make([]interfaces.Task, len(items))
+	for i, item := range items {
+		tasks[i] = item.task
+		tasks[i].ReceiptHandle = claim
+	}
+	return tasks, nil
+}
+
+// Ack deletes the task if it still holds the claim it was popped with, like
+// Nack and ExtendLease.
+func (s *SQLStore) Ack(task interfaces.Task) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE id = ? AND claim = ?`, s.table)
+	res, err := s.db.ExecContext(context.Background(), s.dialect.Rebind(query), task.ID, task.ReceiptHandle)
+	if err != nil {
+		return fmt.Errorf("failed to ack task: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("task not found in pending")
+	}
+	return nil
+}
+
+func (s *SQLStore) AckBatch(tasks []interfaces.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, 2*len(tasks))
+	for _, task := range tasks {
+		args = append(args, task.ID, task.ReceiptHandle)
+	}
+
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	conditions := strings.TrimSuffix(strings.Repeat("(id = ? AND claim = ?) OR ", len(tasks)), " OR ")
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s RETURNING id, claim`, s.table, conditions)
+	deleted, err := s.deletedRows(s.dialect.Rebind(query), args)
+	if err != nil {
+		for i := range tasks {
+			result.Errors[i] = fmt.Errorf("failed to ack task: %w", err)
+		}
+		return result
+	}
+
+	for i, task := range tasks {
+		if !deleted[[2]string{task.ID, task.ReceiptHandle}] {
+			result.Errors[i] = errors.New("task not found in pending")
+		}
+	}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+// deletedRows runs a DELETE ... RETURNING id, claim and returns the deleted
+// rows.
+func (s *SQLStore) deletedRows(query string, args []any) (map[[2]string]bool, error) {
+	rows, err := s.db.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deleted := make(map[[2]string]bool)
+	for rows.Next() {
+		var id, claim string
+		if err := rows.Scan(&id, &claim); err != nil {
+			return nil, err
+		}
+		deleted[[2]string{id, claim}] = true
+	}
+	return deleted, rows.Err()
+}
+
+// Nack drops the claim, so the task can only be settled again once popped.
+func (s *SQLStore) Nack(task interfaces.Task, delay time.Duration) error {
+	return s.setAvailable(task, delay, "", "nack")
+}
+
+// ExtendLease pushes the task's available_at forward so it is not handed out
+// again while still running.
+func (s *SQLStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	return s.setAvailable(task, lease, task.ReceiptHandle, "extend lease of")
+}
+
+func (s *SQLStore) setAvailable(task interfaces.Task, delay time.Duration, claim, action string) error {
+	query := fmt.Sprintf(`UPDATE %s SET available_at = ?, claim = ? WHERE id = ? AND claim = ?`, s.table)
+	res, err := s.db.ExecContext(context.Background(), s.dialect.Rebind(query), time.Now().Add(delay).UnixMilli(), claim, task.ID, task.ReceiptHandle)
+	if err != nil {
+		return fmt.Errorf("failed to %s task: %w", action, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("task not found in pending")
+	}
+	return nil
+}
+
+func (s *SQLStore) SetPaused(name string, paused bool) error {
+	var query string
+	switch {
+	case !paused:
+		query = `DELETE FROM %s_paused WHERE name = ?`
+	case s.dialect == Postgres:
+		query = `INSERT INTO %s_paused (name) VALUES (?) ON CONFLICT DO NOTHING`
+	default:
+		query = `INSERT OR IGNORE INTO %s_paused (name) VALUES (?)`
+	}
+
+	if _, err := s.db.ExecContext(context.Background(), s.dialect.Rebind(fmt.Sprintf(query, s.table)), name); err != nil {
+		return fmt.Errorf("failed to update paused tasks: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) PausedNames() ([]string, error) {
+	rows, err := s.db.QueryContext(context.Background(), fmt.Sprintf(`SELECT name FROM %s_paused`, s.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paused tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read paused tasks: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
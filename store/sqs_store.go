@@ -2,66 +2,383 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
 
 	"github.com/Thauan/gotsk/interfaces"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
+const (
+	maxBatchSize         = 10
+	maxFIFOIDLength      = 128
+	maxDelay             = 15 * time.Minute
+	maxVisibilityTimeout = 12 * time.Hour
+
+	attrTaskID      = "gotsk.id"
+	attrTaskName    = "gotsk.name"
+	attrPriority    = "gotsk.priority"
+	attrScheduledAt = "gotsk.scheduled_at"
+)
+
+// SQSAPI is the subset of *sqs.Client used by SQSStore.
+type SQSAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// SQSStore keeps the whole task as the message body and mirrors its metadata
+// in message attributes. ScheduledAt is mapped to DelaySeconds; tasks due
+// further than SQS's 15 minute limit are delayed again when received early.
 type SQSStore struct {
-	client   *sqs.Client
-	queueURL string
+	client     SQSAPI
+	queueURL   string
+	fifo       bool
+	groupField string
 }
 
-func NewSQSStore(client *sqs.Client, queueURL string) *SQSStore {
-	return &SQSStore{
+type SQSOption func(*SQSStore)
+
+// WithFIFO targets a FIFO queue. The message group is the task's GroupKey,
+// falling back to the payload field groupField and then to the task name.
+// The deduplication ID is the task's UniqueKey, falling back to its ID.
+func WithFIFO(groupField string) SQSOption {
+	return func(s *SQSStore) {
+		s.fifo = true
+		s.groupField = groupField
+	}
+}
+
+func NewSQSStore(client SQSAPI, queueURL string, opts ...SQSOption) *SQSStore {
+	s := &SQSStore{
 		client:   client,
 		queueURL: queueURL,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *SQSStore) Push(task interfaces.Task) error {
-	data, err := json.Marshal(struct {
-		Name    string
-		Payload interfaces.Payload
-	}{task.Name, task.Payload})
+	body, err := json.Marshal(task)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal task: %w", err)
 	}
 
-	_, err = s.client.SendMessage(context.TODO(), &sqs.SendMessageInput{
-		QueueUrl:    &s.queueURL,
-		MessageBody: aws.String(string(data)),
-	})
-	return err
+	input := &sqs.SendMessageInput{
+		QueueUrl:          &s.queueURL,
+		MessageBody:       aws.String(string(body)),
+		MessageAttributes: messageAttributes(task),
+	}
+	if s.fifo {
+		input.MessageGroupId = aws.String(s.groupID(task))
+		input.MessageDeduplicationId = aws.String(s.deduplicationID(task))
+	} else {
+		input.DelaySeconds = delaySeconds(task.ScheduledAt)
+	}
+
+	_, err = s.client.SendMessage(context.TODO(), input)
+	if err != nil {
+		return fmt.Errorf("failed to send message to SQS: %w", err)
+	}
+
+	return nil
 }
 
-func (s *SQSStore) Pop() (interfaces.Task, error) {
-	out, err := s.client.ReceiveMessage(context.TODO(), &sqs.ReceiveMessageInput{
-		QueueUrl:            &s.queueURL,
-		MaxNumberOfMessages: 1,
-		WaitTimeSeconds:     10,
-	})
-	if err != nil || len(out.Messages) == 0 {
-		return interfaces.Task{}, errors.New("no messages received")
+func (s *SQSStore) PushBatch(tasks []interfaces.Task) error {
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+
+	for start := 0; start < len(tasks); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(tasks))
+
+		var entries []types.SendMessageBatchRequestEntry
+		for i := start; i < end; i++ {
+			body, err := json.Marshal(tasks[i])
+			if err != nil {
+				result.Errors[i] = fmt.Errorf("failed to marshal task: %w", err)
+				continue
+			}
+			entry := types.SendMessageBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				MessageBody:       aws.String(string(body)),
+				MessageAttributes: messageAttributes(tasks[i]),
+			}
+			if s.fifo {
+				entry.MessageGroupId = aws.String(s.groupID(tasks[i]))
+				entry.MessageDeduplicationId = aws.String(s.deduplicationID(tasks[i]))
+			} else {
+				entry.DelaySeconds = delaySeconds(tasks[i].ScheduledAt)
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		out, err := s.client.SendMessageBatch(context.TODO(), &sqs.SendMessageBatchInput{
+			QueueUrl: &s.queueURL,
+			Entries:  entries,
+		})
+		if err != nil {
+			for _, entry := range entries {
+				i, _ := strconv.Atoi(*entry.Id)
+				result.Errors[i] = fmt.Errorf("failed to send message batch to SQS: %w", err)
+			}
+			continue
+		}
+
+		for _, failed := range out.Failed {
+			i, _ := strconv.Atoi(aws.ToString(failed.Id))
+			result.Errors[i] = fmt.Errorf("failed to send message: %s", aws.ToString(failed.Message))
+		}
 	}
 
-	msg := out.Messages[0]
-	var task interfaces.Task
-	if err := json.Unmarshal([]byte(*msg.Body), &task); err != nil {
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *SQSStore) Pop() (interfaces.Task, error) {
+	tasks, err := s.PopBatch(1)
+	if err != nil {
 		return interfaces.Task{}, err
 	}
-	task.ReceiptHandle = *msg.ReceiptHandle
+	if len(tasks) == 0 {
+		return interfaces.Task{}, errors.New("no tasks available")
+	}
+	return tasks[0], nil
+}
 
-	return task, nil
+func (s *SQSStore) PopBatch(max int) ([]interfaces.Task, error) {
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:              &s.queueURL,
+		MaxNumberOfMessages:   int32(min(max, maxBatchSize)),
+		WaitTimeSeconds:       10,
+		MessageAttributeNames: []string{"All"},
+	}
+	if s.fifo {
+		input.MessageSystemAttributeNames = []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameMessageGroupId,
+		}
+	}
+
+	out, err := s.client.ReceiveMessage(context.TODO(), input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive message: %w", err)
+	}
+
+	tasks := make([]interfaces.Task, 0, len(out.Messages))
+	held := make(map[string]bool)
+	for _, msg := range out.Messages {
+		task, err := decodeMessage(msg)
+		if err != nil {
+			// Left invisible for the queue's redrive policy to move it to a
+			// dead-letter queue; later messages of its group wait for it.
+			log.Printf("⚠️ Mensagem SQS %s inválida ignorada: %v", aws.ToString(msg.MessageId), err)
+			held[msg.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]] = true
+			continue
+		}
+
+		if s.fifo && held[task.GroupKey] {
+			if err := s.Nack(task, 0); err != nil {
+				return tasks, err
+			}
+			continue
+		}
+
+		if task.ScheduledAt.After(time.Now()) {
+			if err := s.redelay(task); err != nil {
+				return tasks, err
+			}
+			held[task.GroupKey] = true
+			continue
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// redelay sends a task received before its ScheduledAt back with the
+// remaining delay and deletes the early copy. FIFO queues have no per-message
+// delay and would drop the copy as a duplicate, so there the message is hidden
+// instead, which also holds back the rest of its group.
+func (s *SQSStore) redelay(task interfaces.Task) error {
+	if s.fifo {
+		return s.Nack(task, time.Until(task.ScheduledAt))
+	}
+	if err := s.Push(task); err != nil {
+		return err
+	}
+	return s.Ack(task)
 }
 
 func (s *SQSStore) Ack(task interfaces.Task) error {
+	if task.ReceiptHandle == "" {
+		return fmt.Errorf("receipt handle not found for task ID: %s", task.ID)
+	}
+
 	_, err := s.client.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
 		QueueUrl:      &s.queueURL,
 		ReceiptHandle: &task.ReceiptHandle,
 	})
-	return err
+	if err != nil {
+		return fmt.Errorf("failed to delete message from SQS: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQSStore) AckBatch(tasks []interfaces.Task) error {
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+
+	for start := 0; start < len(tasks); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(tasks))
+
+		entries := make([]types.DeleteMessageBatchRequestEntry, 0, end-start)
+		for i := start; i < end; i++ {
+			entries = append(entries, types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: aws.String(tasks[i].ReceiptHandle),
+			})
+		}
+
+		out, err := s.client.DeleteMessageBatch(context.TODO(), &sqs.DeleteMessageBatchInput{
+			QueueUrl: &s.queueURL,
+			Entries:  entries,
+		})
+		if err != nil {
+			for i := start; i < end; i++ {
+				result.Errors[i] = fmt.Errorf("failed to delete message batch from SQS: %w", err)
+			}
+			continue
+		}
+
+		for _, failed := range out.Failed {
+			i, _ := strconv.Atoi(aws.ToString(failed.Id))
+			result.Errors[i] = fmt.Errorf("failed to delete message: %s", aws.ToString(failed.Message))
+		}
+	}
+
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func (s *SQSStore) Nack(task interfaces.Task, delay time.Duration) error {
+	if task.ReceiptHandle == "" {
+		return fmt.Errorf("receipt handle not found for task ID: %s", task.ID)
+	}
+
+	_, err := s.client.ChangeMessageVisibility(context.TODO(), &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          &s.queueURL,
+		ReceiptHandle:     &task.ReceiptHandle,
+		VisibilityTimeout: int32((min(max(delay, 0), maxVisibilityTimeout) + time.Second - 1) / time.Second),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change message visibility: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQSStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	return s.Nack(task, lease)
+}
+
+func (s *SQSStore) groupID(task interfaces.Task) string {
+	if task.GroupKey != "" {
+		return fifoID(task.GroupKey)
+	}
+	if value, ok := task.Payload[s.groupField]; ok && s.groupField != "" {
+		return fifoID(fmt.Sprint(value))
+	}
+	return fifoID(task.Name)
+}
+
+func (s *SQSStore) deduplicationID(task interfaces.Task) string {
+	if task.UniqueKey != "" {
+		return fifoID(task.UniqueKey)
+	}
+	return fifoID(task.ID)
+}
+
+// fifoID keeps group and deduplication IDs within SQS's 128 character limit.
+func fifoID(id string) string {
+	if len(id) <= maxFIFOIDLength {
+		return id
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+func messageAttributes(task interfaces.Task) map[string]types.MessageAttributeValue {
+	attrs := map[string]types.MessageAttributeValue{
+		attrTaskID:   {DataType: aws.String("String"), StringValue: aws.String(task.ID)},
+		attrTaskName: {DataType: aws.String("String"), StringValue: aws.String(task.Name)},
+		attrPriority: {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(task.Priority))},
+	}
+	if task.ID == "" {
+		delete(attrs, attrTaskID)
+	}
+	if !task.ScheduledAt.IsZero() {
+		attrs[attrScheduledAt] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(task.ScheduledAt.Format(time.RFC3339Nano)),
+		}
+	}
+	return attrs
+}
+
+// decodeMessage reads the current format as well as the two legacy ones: the
+// full task marshalled with lowercase keys, and {"Name", "Payload"} without an
+// ID, which gets the attribute or message ID instead.
+func decodeMessage(msg types.Message) (interfaces.Task, error) {
+	var task interfaces.Task
+	if err := json.Unmarshal([]byte(aws.ToString(msg.Body)), &task); err != nil {
+		return interfaces.Task{}, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+
+	if task.ID == "" {
+		if attr, ok := msg.MessageAttributes[attrTaskID]; ok {
+			task.ID = aws.ToString(attr.StringValue)
+		} else {
+			task.ID = aws.ToString(msg.MessageId)
+		}
+	}
+	if task.Name == "" {
+		if attr, ok := msg.MessageAttributes[attrTaskName]; ok {
+			task.Name = aws.ToString(attr.StringValue)
+		}
+	}
+	if task.GroupKey == "" {
+		task.GroupKey = msg.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+	}
+	task.ReceiptHandle = aws.ToString(msg.ReceiptHandle)
+
+	return task, nil
+}
+
+func delaySeconds(at time.Time) int32 {
+	wait := time.Until(at)
+	if wait <= 0 {
+		return 0
+	}
+	return int32(min(wait+time.Second-1, maxDelay) / time.Second)
 }
@@ -0,0 +1,306 @@
+// Package storetest checks that a TaskStore behaves the way Queue expects.
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+//			return mystore.New(...)
+//		})
+//	}
+package storetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty store. It is called once per test; closing the
+// store is left to t.Cleanup.
+type Factory func(t *testing.T) interfaces.TaskStore
+
+// Restart returns a store reading the same backend as s, as a new process
+// would after s crashed.
+type Restart func(t *testing.T, s interfaces.TaskStore) interfaces.TaskStore
+
+type Option func(*config)
+
+type config struct {
+	tick      time.Duration
+	priority  bool
+	unordered bool
+	lease     time.Duration
+	restart   Restart
+}
+
+// WithTick sets the delay used by the scheduling tests. Stores with coarse
+// timers, like SQS, need a longer tick. Defaults to 200 milliseconds.
+func WithTick(d time.Duration) Option {
+	return func(c *config) {
+		c.tick = d
+	}
+}
+
+// WithPriority checks that tasks with a higher Priority are popped first.
+func WithPriority() Option {
+	return func(c *config) {
+		c.priority = true
+	}
+}
+
+// WithUnordered skips the FIFO check, for stores that only order tasks on a
+// best-effort basis.
+func WithUnordered() Option {
+	return func(c *config) {
+		c.unordered = true
+	}
+}
+
+// WithLease checks that a task popped but never acked is handed out again
+// after lease. The lease must be longer than half a tick.
+func WithLease(lease time.Duration) Option {
+	return func(c *config) {
+		c.lease = lease
+	}
+}
+
+// WithRestart checks that a task popped but never acked is handed out again
+// by the store returned by restart.
+func WithRestart(restart Restart) Option {
+	return func(c *config) {
+		c.restart = restart
+	}
+}
+
+// Run runs the suite against stores created by newStore.
+func Run(t *testing.T, newStore Factory, opts ...Option) {
+	c := &config{tick: 200 * time.Millisecond}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	t.Run("Ordering", func(t *testing.T) {
+		if c.unordered {
+			t.Skip("store does not keep FIFO order")
+		}
+		c.testOrdering(t, newStore(t))
+	})
+	t.Run("Priority", func(t *testing.T) {
+		if !c.priority {
+			t.Skip("store does not order by priority")
+		}
+		c.testPriority(t, newStore(t))
+	})
+	t.Run("Scheduling", func(t *testing.T) { c.testScheduling(t, newStore(t)) })
+	t.Run("Ack", func(t *testing.T) { c.testAck(t, newStore(t)) })
+	t.Run("Nack", func(t *testing.T) { c.testNack(t, newStore(t)) })
+	t.Run("ConcurrentPop", func(t *testing.T) { c.testConcurrentPop(t, newStore(t)) })
+	t.Run("PendingRecovery", func(t *testing.T) {
+		if c.lease == 0 && c.restart == nil {
+			t.Skip("store does not recover pending tasks")
+		}
+		c.testPendingRecovery(t, newStore(t))
+	})
+}
+
+// wait is how long pop keeps polling. Stores that fetch in the background may
+// hand out a task a little after it was pushed.
+func (c *config) wait() time.Duration {
+	return max(2*time.Second, 5*c.tick)
+}
+
+func (c *config) pop(t *testing.T, s interfaces.TaskStore) interfaces.Task {
+	t.Helper()
+
+	deadline := time.Now().Add(c.wait())
+	for {
+		task, err := s.Pop()
+		if err == nil {
+			return task
+		}
+		if time.Now().After(deadline) {
+			require.FailNow(t, "no task popped", "last error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// assertEmpty checks that nothing is popped for half a tick.
+func (c *config) assertEmpty(t *testing.T, s interfaces.TaskStore) {
+	t.Helper()
+
+	deadline := time.Now().Add(c.tick / 2)
+	for time.Now().Before(deadline) {
+		if task, err := s.Pop(); err == nil {
+			assert.Fail(t, "unexpected task popped", "task %s", task.ID)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func task(id string) interfaces.Task {
+	return interfaces.Task{ID: id, Name: "storetest", Payload: interfaces.Payload{"id": id}}
+}
+
+func (c *config) testOrdering(t *testing.T, s interfaces.TaskStore) {
+	for i := range 5 {
+		require.NoError(t, s.Push(task(fmt.Sprintf("task-%d", i))))
+	}
+
+	for i := range 5 {
+		popped := c.pop(t, s)
+		assert.Equal(t, fmt.Sprintf("task-%d", i), popped.ID)
+		assert.Equal(t, "storetest", popped.Name)
+		assert.Equal(t, popped.ID, popped.Payload["id"])
+		assert.NoError(t, s.Ack(popped))
+	}
+}
+
+func (c *config) testPriority(t *testing.T, s interfaces.TaskStore) {
+	for _, p := range []struct {
+		id       string
+		priority int
+	}{{"low", 0}, {"high", 5}, {"mid", 1}} {
+		tk := task(p.id)
+		tk.Priority = p.priority
+		require.NoError(t, s.Push(tk))
+	}
+
+	for _, id := range []string{"high", "mid", "low"} {
+		popped := c.pop(t, s)
+		assert.Equal(t, id, popped.ID)
+		assert.NoError(t, s.Ack(popped))
+	}
+}
+
+// early is how much sooner than due a task may be handed out, for stores
+// that keep times at millisecond precision.
+const early = 10 * time.Millisecond
+
+func (c *config) testScheduling(t *testing.T, s interfaces.TaskStore) {
+	scheduled := task("scheduled")
+	scheduled.ScheduledAt = time.Now().Add(c.tick)
+	require.NoError(t, s.Push(scheduled))
+	require.NoError(t, s.Push(task("now")))
+
+	popped := c.pop(t, s)
+	assert.Equal(t, "now", popped.ID)
+	assert.NoError(t, s.Ack(popped))
+	c.assertEmpty(t, s)
+
+	popped = c.pop(t, s)
+	assert.Equal(t, "scheduled", popped.ID)
+	assert.False(t, time.Now().Before(scheduled.ScheduledAt.Add(-early)), "task popped before it was due")
+	assert.NoError(t, s.Ack(popped))
+}
+
+func (c *config) testAck(t *testing.T, s interfaces.TaskStore) {
+	require.NoError(t, s.Push(task("task-1")))
+
+	popped := c.pop(t, s)
+	assert.NoError(t, s.Ack(popped))
+	assert.Error(t, s.Nack(popped, 0), "nack after ack should fail")
+	c.assertEmpty(t, s)
+
+	if c.lease > 0 {
+		time.Sleep(c.lease)
+		c.assertEmpty(t, s)
+	}
+	if c.restart != nil {
+		c.assertEmpty(t, c.restart(t, s))
+	}
+}
+
+func (c *config) testNack(t *testing.T, s interfaces.TaskStore) {
+	require.NoError(t, s.Push(task("task-1")))
+
+	popped := c.pop(t, s)
+	assert.NoError(t, s.Nack(popped, 0))
+
+	popped = c.pop(t, s)
+	assert.Equal(t, "task-1", popped.ID)
+
+	nacked := time.Now()
+	assert.NoError(t, s.Nack(popped, c.tick))
+	c.assertEmpty(t, s)
+
+	popped = c.pop(t, s)
+	assert.Equal(t, "task-1", popped.ID)
+	assert.False(t, time.Now().Before(nacked.Add(c.tick-early)), "task popped before its delay")
+	assert.NoError(t, s.Ack(popped))
+}
+
+func (c *config) testConcurrentPop(t *testing.T, s interfaces.TaskStore) {
+	const tasks, workers = 40, 8
+	for i := range tasks {
+		require.NoError(t, s.Push(task(fmt.Sprintf("task-%d", i))))
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	total := 0
+
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(c.wait())
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				mu.Lock()
+				done := total >= tasks
+				mu.Unlock()
+				if done {
+					return
+				}
+
+				popped, err := s.Pop()
+				if err != nil {
+					time.Sleep(5 * time.Millisecond)
+					continue
+				}
+				mu.Lock()
+				seen[popped.ID]++
+				total++
+				mu.Unlock()
+				assert.NoError(t, s.Ack(popped))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, tasks)
+	for id, n := range seen {
+		assert.Equal(t, 1, n, "task %s delivered %d times", id, n)
+	}
+}
+
+func (c *config) testPendingRecovery(t *testing.T, s interfaces.TaskStore) {
+	if c.lease > 0 {
+		require.NoError(t, s.Push(task("leased")))
+		popped := c.pop(t, s)
+		assert.Equal(t, "leased", popped.ID)
+		c.assertEmpty(t, s)
+
+		time.Sleep(c.lease)
+		popped = c.pop(t, s)
+		assert.Equal(t, "leased", popped.ID)
+		assert.NoError(t, s.Ack(popped))
+	}
+
+	if c.restart != nil {
+		require.NoError(t, s.Push(task("crashed")))
+		popped := c.pop(t, s)
+		assert.Equal(t, "crashed", popped.ID)
+
+		restarted := c.restart(t, s)
+		popped = c.pop(t, restarted)
+		assert.Equal(t, "crashed", popped.ID)
+		assert.NoError(t, restarted.Ack(popped))
+		c.assertEmpty(t, restarted)
+	}
+}
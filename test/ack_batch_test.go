@@ -0,0 +1,164 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchAckStore struct {
+	*gotsk.MemoryStore
+	mu      sync.Mutex
+	batches []int
+	failed  bool
+}
+
+func (s *batchAckStore) AckBatch(tasks []interfaces.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, len(tasks))
+
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	for i, task := range tasks {
+		if !s.failed {
+			s.failed = true
+			result.Errors[i] = errors.New("throttled")
+			continue
+		}
+		result.Errors[i] = s.MemoryStore.Ack(task)
+	}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func TestAckBatching(t *testing.T) {
+	memory := &batchAckStore{MemoryStore: gotsk.NewMemoryStore()}
+	queue := gotsk.NewWithStore(4, memory, gotsk.WithAckBatching(5, time.Hour))
+
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		return nil
+	})
+
+	for i := range 12 {
+		assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"n": i}))
+	}
+
+	queue.Start()
+	time.Sleep(500 * time.Millisecond)
+
+	assert.Equal(t, 0, memory.LenQueue())
+	assert.Greater(t, memory.LenPending(), 0)
+
+	report := queue.Stop()
+
+	assert.NoError(t, report.Err)
+	assert.Equal(t, 0, memory.LenPending())
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	for _, size := range memory.batches[:2] {
+		assert.GreaterOrEqual(t, size, 5)
+	}
+}
+
+func TestAckBatchingWindow(t *testing.T) {
+	memory := &batchAckStore{MemoryStore: gotsk.NewMemoryStore(), failed: true}
+	queue := gotsk.NewWithStore(1, memory, gotsk.WithAckBatching(100, 200*time.Millisecond))
+
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		return nil
+	})
+
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"n": 1}))
+
+	queue.Start()
+	defer queue.Stop()
+	time.Sleep(500 * time.Millisecond)
+
+	assert.Equal(t, 0, memory.LenPending())
+}
+
+func TestRedisStoreAckBatch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+
+	for _, id := range []string{"task-1", "task-2"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "send_email"}))
+	}
+
+	tasks, err := s.PopBatch(2)
+	assert.NoError(t, err)
+	assert.NoError(t, s.AckBatch(tasks))
+
+	assert.False(t, mr.Exists("gotsk:pending"))
+}
+
+func TestRedisStoreAcksByID(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+
+	for _, id := range []string{"task-1", "task-2", "task-3", "task-4"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "send_email", GroupKey: "account-1"}))
+	}
+	mr.Lpush("gotsk:pending", "{not json")
+
+	// The JSON of a popped task may differ from the stored one by the time
+	// it is settled; acks and nacks still find it by ID.
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	task.Retries = 1
+	task.Payload = interfaces.Payload{"changed": true}
+	assert.NoError(t, s.Nack(task, 0))
+
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.Equal(t, 1, task.Retries)
+	task.Retries = 2
+	assert.NoError(t, s.Ack(task))
+	assert.EqualError(t, s.Ack(task), "task not found in pending")
+
+	first, err := s.Pop()
+	assert.NoError(t, err)
+	first.Retries = 3
+	err = s.AckBatch([]interfaces.Task{first, {ID: "missing"}})
+	var batchErr *interfaces.BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.NoError(t, batchErr.Errors[0])
+	assert.EqualError(t, batchErr.Errors[1], "task not found in pending")
+
+	// The group is unlocked, so its next task is handed out.
+	next, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-3", next.ID)
+	assert.NoError(t, s.Ack(next))
+
+	pending, err := mr.List("gotsk:pending")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"{not json"}, pending)
+}
+
+func TestAckBatchingWithoutWindow(t *testing.T) {
+	memory := &batchAckStore{MemoryStore: gotsk.NewMemoryStore(), failed: true}
+	queue := gotsk.NewWithStore(1, memory, gotsk.WithAckBatching(10, 0))
+
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		return nil
+	})
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"n": 1}))
+
+	queue.Start()
+	defer queue.Stop()
+
+	assert.Eventually(t, func() bool { return memory.LenQueue() == 0 && memory.LenPending() == 0 }, 2*time.Second, 10*time.Millisecond)
+}
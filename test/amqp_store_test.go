@@ -0,0 +1,382 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBroker is an in-process stand-in for RabbitMQ's default exchange:
+// durable queues with priorities, per-queue TTL, dead-lettering, prefetch and
+// publisher confirms.
+type fakeBroker struct {
+	mu       sync.Mutex
+	queues   map[string]*fakeAMQPQueue
+	channels []*fakeAMQPChannel
+	hold     bool
+}
+
+type fakeAMQPQueue struct {
+	args     amqp.Table
+	messages []amqp.Publishing
+}
+
+type fakeAMQPChannel struct {
+	broker     *fakeBroker
+	prefetch   int
+	queue      string
+	tag        uint64
+	confirms   chan amqp.Confirmation
+	closes     []chan *amqp.Error
+	deliveries chan amqp.Delivery
+	unacked    map[uint64]amqp.Publishing
+	closed     bool
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{queues: make(map[string]*fakeAMQPQueue)}
+}
+
+func (b *fakeBroker) dial() (store.AMQPChannel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := &fakeAMQPChannel{broker: b, unacked: make(map[uint64]amqp.Publishing)}
+	b.channels = append(b.channels, ch)
+	return ch, nil
+}
+
+func (b *fakeBroker) messages(queue string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if q, ok := b.queues[queue]; ok {
+		return append([]amqp.Publishing(nil), q.messages...)
+	}
+	return nil
+}
+
+func (b *fakeBroker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hold = false
+	b.dispatch()
+}
+
+// kill drops every channel as a lost connection would.
+func (b *fakeBroker) kill() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.channels {
+		ch.close(&amqp.Error{Code: amqp.ConnectionForced, Reason: "connection lost"})
+	}
+	b.dispatch()
+}
+
+// enqueue routes msg through the default exchange. Messages in a queue with
+// x-message-ttl are dead-lettered when it expires. Callers hold b.mu.
+func (b *fakeBroker) enqueue(queue string, msg amqp.Publishing, front bool) {
+	q, ok := b.queues[queue]
+	if !ok {
+		return
+	}
+	if front {
+		q.messages = append([]amqp.Publishing{msg}, q.messages...)
+	} else {
+		q.messages = append(q.messages, msg)
+	}
+
+	if ttl, ok := q.args["x-message-ttl"].(int64); ok {
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			for i, m := range q.messages {
+				if m.MessageId == msg.MessageId {
+					q.messages = append(q.messages[:i], q.messages[i+1:]...)
+					b.enqueue(q.args["x-dead-letter-routing-key"].(string), m, false)
+					break
+				}
+			}
+			b.dispatch()
+		})
+	}
+}
+
+// dispatch hands out messages, highest priority first, to consumers with
+// prefetch room. Callers hold b.mu.
+func (b *fakeBroker) dispatch() {
+	if b.hold {
+		return
+	}
+	for _, ch := range b.channels {
+		q, ok := b.queues[ch.queue]
+		if ch.closed || !ok {
+			continue
+		}
+		for len(q.messages) > 0 && len(ch.unacked) < ch.prefetch {
+			best := 0
+			for i, m := range q.messages {
+				if m.Priority > q.messages[best].Priority {
+					best = i
+				}
+			}
+			msg := q.messages[best]
+			q.messages = append(q.messages[:best], q.messages[best+1:]...)
+
+			ch.tag++
+			ch.unacked[ch.tag] = msg
+			ch.deliveries <- amqp.Delivery{
+				Acknowledger: ch,
+				DeliveryTag:  ch.tag,
+				MessageId:    msg.MessageId,
+				Priority:     msg.Priority,
+				Body:         msg.Body,
+			}
+		}
+	}
+}
+
+func (c *fakeAMQPChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if _, ok := c.broker.queues[name]; !ok {
+		c.broker.queues[name] = &fakeAMQPQueue{args: args}
+	}
+	return amqp.Queue{Name: name}, nil
+}
+
+func (c *fakeAMQPChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	c.prefetch = prefetchCount
+	return nil
+}
+
+func (c *fakeAMQPChannel) Confirm(noWait bool) error { return nil }
+
+func (c *fakeAMQPChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	c.confirms = confirm
+	return confirm
+}
+
+func (c *fakeAMQPChannel) NotifyClose(ch chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.closes = append(c.closes, ch)
+	return ch
+}
+
+func (c *fakeAMQPChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.broker.enqueue(key, msg, false)
+	c.broker.dispatch()
+	c.confirms <- amqp.Confirmation{Ack: true}
+	return nil
+}
+
+func (c *fakeAMQPChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.queue = queue
+	c.deliveries = make(chan amqp.Delivery, c.prefetch)
+	c.broker.dispatch()
+	return c.deliveries, nil
+}
+
+func (c *fakeAMQPChannel) Close() error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	c.close(nil)
+	c.broker.dispatch()
+	return nil
+}
+
+// close requeues unacked messages at the front of the queue. Callers hold
+// b.mu.
+func (c *fakeAMQPChannel) close(reason *amqp.Error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for tag := c.tag; tag > 0; tag-- {
+		if msg, ok := c.unacked[tag]; ok {
+			c.broker.enqueue(c.queue, msg, true)
+		}
+	}
+	c.unacked = nil
+	for _, ch := range c.closes {
+		if reason != nil {
+			ch <- reason
+		}
+		close(ch)
+	}
+	if c.deliveries != nil {
+		close(c.deliveries)
+	}
+}
+
+func (c *fakeAMQPChannel) settle(tag uint64, requeue, dead bool) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	msg, ok := c.unacked[tag]
+	if !ok {
+		return amqp.ErrClosed
+	}
+	delete(c.unacked, tag)
+
+	q := c.broker.queues[c.queue]
+	switch {
+	case requeue:
+		c.broker.enqueue(c.queue, msg, true)
+	case dead:
+		c.broker.enqueue(q.args["x-dead-letter-routing-key"].(string), msg, false)
+	}
+	c.broker.dispatch()
+	return nil
+}
+
+func (c *fakeAMQPChannel) Ack(tag uint64, multiple bool) error {
+	return c.settle(tag, false, false)
+}
+
+func (c *fakeAMQPChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	return c.settle(tag, requeue, !requeue)
+}
+
+func (c *fakeAMQPChannel) Reject(tag uint64, requeue bool) error {
+	return c.settle(tag, requeue, !requeue)
+}
+
+func newAMQPStore(t *testing.T, broker *fakeBroker) *store.AMQPStore {
+	s, err := store.NewAMQPStore(broker.dial, "tasks",
+		store.WithAMQPPrefetch(5),
+		store.WithAMQPDelayPrecision(100*time.Millisecond),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestAMQPStoreNack(t *testing.T) {
+	testNack(t, newAMQPStore(t, newFakeBroker()))
+}
+
+func TestAMQPStorePriority(t *testing.T) {
+	broker := newFakeBroker()
+	s := newAMQPStore(t, broker)
+	assert.Equal(t, int32(10), broker.queues["tasks"].args["x-max-priority"])
+
+	broker.hold = true
+	assert.NoError(t, s.Push(interfaces.Task{ID: "low", Name: "send_email", Priority: 1}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "high", Name: "send_email", Priority: 50}))
+
+	msgs := broker.messages("tasks")
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, amqp.Persistent, msgs[0].DeliveryMode)
+	assert.Equal(t, uint8(10), msgs[1].Priority)
+
+	broker.release()
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "high", tasks[0].ID)
+	assert.Equal(t, "low", tasks[1].ID)
+	assert.NoError(t, s.Ack(tasks[0]))
+	assert.NoError(t, s.Ack(tasks[1]))
+}
+
+func TestAMQPStoreScheduledAndDeadLetter(t *testing.T) {
+	broker := newFakeBroker()
+	s := newAMQPStore(t, broker)
+
+	assert.NoError(t, s.Push(interfaces.Task{
+		ID:          "task-1",
+		Name:        "send_email",
+		ScheduledAt: time.Now().Add(250 * time.Millisecond),
+	}))
+	assert.Len(t, broker.messages("tasks.delay.300"), 1)
+
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(400 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+
+	assert.NoError(t, s.DeadLetter(task))
+	dead := broker.messages("tasks.dead")
+	assert.Len(t, dead, 1)
+
+	var deadTask interfaces.Task
+	assert.NoError(t, json.Unmarshal(dead[0].Body, &deadTask))
+	assert.Equal(t, "task-1", deadTask.ID)
+}
+
+func TestQueueDeadLettersFailedAMQPTask(t *testing.T) {
+	broker := newFakeBroker()
+	s, err := store.NewAMQPStore(broker.dial, "tasks", store.WithAMQPPrefetch(1))
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	queue := gotsk.NewWithStore(1, s)
+	done := make(chan struct{})
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		if payload["to"] == "bad" {
+			return errors.New("mailbox does not exist")
+		}
+		close(done)
+		return nil
+	})
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"to": "bad"}))
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"to": "good"}))
+
+	// The failed delivery must be settled, or it holds the only prefetch slot.
+	queue.Start()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("queue stalled behind the failed task")
+	}
+	queue.Stop()
+
+	dead := broker.messages("tasks.dead")
+	assert.Len(t, dead, 1)
+	var deadTask interfaces.Task
+	assert.NoError(t, json.Unmarshal(dead[0].Body, &deadTask))
+	assert.Equal(t, "bad", deadTask.Payload["to"])
+}
+
+func TestAMQPStoreReconnects(t *testing.T) {
+	broker := newFakeBroker()
+	s := newAMQPStore(t, broker)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task, err := s.Pop()
+	assert.NoError(t, err)
+
+	broker.kill()
+	assert.Eventually(t, func() bool {
+		return s.Ack(task) != nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "task-1", tasks[0].ID)
+	assert.Equal(t, "task-2", tasks[1].ID)
+	assert.Len(t, broker.channels, 2)
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueBatch(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(2, memory)
+
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		return nil
+	})
+
+	specs := make([]gotsk.TaskSpec, 100)
+	for i := range specs {
+		specs[i] = gotsk.TaskSpec{Name: "send_email", Payload: interfaces.Payload{"n": i}}
+	}
+
+	assert.NoError(t, queue.EnqueueBatch(specs))
+	assert.Equal(t, 100, memory.LenQueue())
+}
+
+func TestEnqueueBatchPerItemErrors(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(2, memory)
+
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		return nil
+	})
+
+	err := queue.EnqueueBatch([]gotsk.TaskSpec{
+		{Name: "send_email", Payload: interfaces.Payload{"n": 1}},
+		{Name: "missing", Payload: interfaces.Payload{"n": 2}},
+		{Name: "send_email", Payload: interfaces.Payload{"n": 3}, Options: interfaces.TaskOptions{Queue: "missing"}},
+		{Name: "send_email", Payload: interfaces.Payload{"n": 4}},
+	})
+
+	var batchErr *interfaces.BatchError
+	assert.True(t, errors.As(err, &batchErr))
+	assert.Len(t, batchErr.Errors, 4)
+	assert.NoError(t, batchErr.Errors[0])
+	assert.Error(t, batchErr.Errors[1])
+	assert.Error(t, batchErr.Errors[2])
+	assert.NoError(t, batchErr.Errors[3])
+	assert.Equal(t, 2, memory.LenQueue())
+}
+
+func TestRedisStorePushBatch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "task-1", Name: "send_email"},
+		{ID: "task-2", Name: "send_email"},
+		{ID: "task-3", Name: "send_email", ScheduledAt: time.Now().Add(time.Hour)},
+	}))
+
+	for _, id := range []string{"task-1", "task-2"} {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, id, task.ID)
+	}
+
+	_, err := s.Pop()
+	assert.Error(t, err)
+}
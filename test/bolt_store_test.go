@@ -0,0 +1,174 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newBoltStore(t *testing.T, path string, opts ...store.BoltOption) *store.BoltStore {
+	s, err := store.NewBoltStore(path, opts...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestBoltStoreNack(t *testing.T) {
+	testNack(t, newBoltStore(t, filepath.Join(t.TempDir(), "gotsk.db")))
+}
+
+func TestBoltStorePriority(t *testing.T) {
+	s := newBoltStore(t, filepath.Join(t.TempDir(), "gotsk.db"))
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "low", Name: "send_email", Priority: -1},
+		{ID: "normal", Name: "send_email"},
+		{ID: "high", Name: "send_email", Priority: 5},
+		{ID: "normal-2", Name: "send_email"},
+		{ID: "later", Name: "send_email", Priority: 9, ScheduledAt: time.Now().Add(200 * time.Millisecond)},
+	}))
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	assert.Equal(t, []string{"high", "normal", "normal-2", "low"}, ids)
+
+	time.Sleep(300 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "later", task.ID)
+}
+
+func TestBoltStoreRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotsk.db")
+	s, err := store.NewBoltStore(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "task-1", Name: "send_email"},
+		{ID: "task-2", Name: "send_email"},
+		{ID: "task-3", Name: "send_email", ScheduledAt: time.Now().Add(time.Hour)},
+	}))
+	_, err = s.Pop()
+	assert.NoError(t, err)
+	assert.NoError(t, s.SetPaused("report", true))
+
+	_, err = store.NewBoltStore(path)
+	assert.Error(t, err)
+	assert.NoError(t, s.Close())
+
+	s = newBoltStore(t, path)
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "task-1", tasks[0].ID)
+	assert.Equal(t, "task-2", tasks[1].ID)
+
+	names, err := s.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"report"}, names)
+}
+
+func TestBoltStoreDeadTasks(t *testing.T) {
+	s := newBoltStore(t, filepath.Join(t.TempDir(), "gotsk.db"),
+		store.WithBoltLease(100*time.Millisecond), store.WithMaxDeliveries(2))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.NoError(t, s.ExtendLease(task, 300*time.Millisecond))
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	dead, err := s.DeadTasks()
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Error(t, s.Ack(task))
+}
+
+func TestBoltStorePromotesTaskDueWithinMillisecond(t *testing.T) {
+	s := newBoltStore(t, filepath.Join(t.TempDir(), "gotsk.db"))
+
+	for range 50 {
+		due := time.Now().Truncate(time.Millisecond).Add(time.Millisecond - time.Microsecond)
+		assert.NoError(t, s.Push(interfaces.Task{Name: "send_email", ScheduledAt: due}))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for time.Now().Before(due.Add(time.Millisecond)) {
+				s.Pop()
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Pop did not return")
+		}
+	}
+}
+
+func TestBoltStoreDropsDuplicateIDs(t *testing.T) {
+	s := newBoltStore(t, filepath.Join(t.TempDir(), "gotsk.db"))
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Ack(task))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
+
+func TestBoltStoreSurvivesCorruptRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gotsk.db")
+	s, err := store.NewBoltStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	db, err := bolt.Open(path, 0o600, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		ready := tx.Bucket([]byte("ready"))
+		if err := ready.Put([]byte{0}, []byte("{")); err != nil {
+			return err
+		}
+		// A lease whose pending record is gone.
+		return tx.Bucket([]byte("leases")).Put([]byte{0, 0, 0, 0, 0, 0, 0, 1, 'x'}, []byte("x"))
+	}))
+	assert.NoError(t, db.Close())
+
+	s = newBoltStore(t, path)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.NoError(t, s.Ack(task))
+
+	_, err = s.DeadTasks()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/limiter"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConcurrency(t *testing.T) {
+	store := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(4, store)
+
+	var running, peak int32
+	var emails int32
+	queue.Register("generate_pdf", func(ctx context.Context, payload interfaces.Payload) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}, gotsk.MaxConcurrency(1))
+
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		atomic.AddInt32(&emails, 1)
+		return nil
+	})
+
+	for range 3 {
+		assert.NoError(t, queue.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	}
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"key": "email"}))
+
+	queue.Start()
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&emails))
+
+	time.Sleep(3 * time.Second)
+	queue.Stop()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&peak))
+	assert.Equal(t, 0, store.LenQueue())
+	assert.Equal(t, 0, store.LenPending())
+}
+
+func TestGlobalConcurrency(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sem := limiter.NewRedisSemaphore(client, "gotsk", time.Minute)
+
+	store1, store2 := gotsk.NewMemoryStore(), gotsk.NewMemoryStore()
+	queue1 := gotsk.NewWithStore(2, store1)
+	queue2 := gotsk.NewWithStore(2, store2)
+
+	var mu sync.Mutex
+	var running, peak int
+	handler := func(ctx context.Context, payload interfaces.Payload) error {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(100 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	}
+
+	queue1.Register("generate_pdf", handler, gotsk.GlobalConcurrency(sem, 1))
+	queue2.Register("generate_pdf", handler, gotsk.GlobalConcurrency(sem, 1))
+
+	for range 2 {
+		assert.NoError(t, queue1.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+		assert.NoError(t, queue2.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	}
+
+	queue1.Start()
+	queue2.Start()
+	time.Sleep(4 * time.Second)
+	queue1.Stop()
+	queue2.Stop()
+
+	assert.Equal(t, 1, peak)
+	assert.Equal(t, 0, store1.LenQueue()+store2.LenQueue())
+}
+
+func TestRedisSemaphore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sem := limiter.NewRedisSemaphore(client, "gotsk", time.Minute)
+	ctx := context.Background()
+
+	first, ok, err := sem.Acquire(ctx, "generate_pdf", 2)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, ok, err = sem.Acquire(ctx, "generate_pdf", 2)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, ok, err = sem.Acquire(ctx, "generate_pdf", 2)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, sem.Release(ctx, "generate_pdf", first))
+
+	_, ok, err = sem.Acquire(ctx, "generate_pdf", 2)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRedisSemaphoreKeepsLeaseWhileHeld(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sem := limiter.NewRedisSemaphore(client, "gotsk", 300*time.Millisecond)
+	ctx := context.Background()
+
+	token, ok, err := sem.Acquire(ctx, "generate_pdf", 1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(time.Second)
+	_, ok, err = sem.Acquire(ctx, "generate_pdf", 1)
+	assert.NoError(t, err)
+	assert.False(t, ok, "slot lost while held")
+
+	assert.NoError(t, sem.Release(ctx, "generate_pdf", token))
+	token, ok, err = sem.Acquire(ctx, "generate_pdf", 1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, sem.Release(ctx, "generate_pdf", token))
+}
@@ -0,0 +1,285 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// downStore fails every push while down is set. With a gate, pushes wait for
+// it to be closed first.
+type downStore struct {
+	*store.MemoryStore
+	down   atomic.Bool
+	pushes atomic.Int32
+	gate   chan struct{}
+}
+
+func (s *downStore) Push(task interfaces.Task) error {
+	s.pushes.Add(1)
+	if s.gate != nil {
+		<-s.gate
+	}
+	if s.down.Load() {
+		return errors.New("connection refused")
+	}
+	return s.MemoryStore.Push(task)
+}
+
+func newFailoverStore(t *testing.T, primary, fallback interfaces.TaskStore, opts ...store.FailoverOption) *store.FailoverStore {
+	opts = append([]store.FailoverOption{store.WithReplayInterval(20 * time.Millisecond)}, opts...)
+	s := store.NewFailoverStore(primary, fallback, opts...)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestFailoverStoreSpillsAndReplays(t *testing.T) {
+	primary := &downStore{MemoryStore: store.NewMemoryStore()}
+	fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+	s := newFailoverStore(t, primary, fallback)
+
+	primary.down.Store(true)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.NoError(t, s.Push(interfaces.Task{Name: "send_email"}))
+	assert.Equal(t, 0, primary.LenQueue())
+
+	primary.down.Store(false)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-3", Name: "send_email"}))
+
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 3 }, 2*time.Second, 10*time.Millisecond)
+
+	var ids []string
+	for range 3 {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Empty(t, task.ReceiptHandle)
+		ids = append(ids, task.ID)
+		assert.NoError(t, s.Ack(task))
+	}
+	assert.Equal(t, "task-1", ids[0])
+	assert.NotEmpty(t, ids[1])
+	assert.Equal(t, "task-3", ids[2])
+
+	_, err := fallback.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-4", Name: "send_email"}))
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestFailoverStoreReplaysInPushOrder(t *testing.T) {
+	primary := &downStore{MemoryStore: store.NewMemoryStore()}
+	fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+	s := newFailoverStore(t, primary, fallback)
+
+	// The BoltStore fallback pops by priority and holds scheduled tasks, but
+	// the spilled tasks reach the primary in push order, as they were pushed.
+	primary.down.Store(true)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email", Priority: 5}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-3", Name: "send_email", ScheduledAt: time.Now().Add(time.Hour)}))
+	assert.NoError(t, s.PushBatch([]interfaces.Task{{ID: "task-4", Name: "send_email", Priority: 10}}))
+	primary.down.Store(false)
+
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 4 }, 2*time.Second, 10*time.Millisecond)
+	for _, want := range []interfaces.Task{
+		{ID: "task-1", Name: "send_email"},
+		{ID: "task-2", Name: "send_email", Priority: 5},
+		{ID: "task-4", Name: "send_email", Priority: 10},
+	} {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, want, task)
+		assert.NoError(t, s.Ack(task))
+	}
+	_, err := s.Pop()
+	assert.Error(t, err)
+}
+
+func TestFailoverStoreDropsMalformedSpilledTask(t *testing.T) {
+	primary := store.NewMemoryStore()
+	fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+	assert.NoError(t, fallback.Push(interfaces.Task{ID: "bad", Name: "send_email", Payload: interfaces.Payload{"gotsk_spilled": "{not json"}}))
+	assert.NoError(t, fallback.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	newFailoverStore(t, primary, fallback)
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 1 }, time.Second, 10*time.Millisecond)
+	_, err := fallback.Pop()
+	assert.Error(t, err)
+}
+
+func TestFailoverStoreBreaker(t *testing.T) {
+	primary := &downStore{MemoryStore: store.NewMemoryStore()}
+	fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+	s := newFailoverStore(t, primary, fallback, store.WithBreaker(2, 300*time.Millisecond))
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, s.Push(interfaces.Task{ID: "probe", Name: "send_email"}))
+		return primary.LenQueue() > 0
+	}, time.Second, 10*time.Millisecond)
+	for primary.LenQueue() > 0 {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.NoError(t, s.Ack(task))
+	}
+
+	primary.down.Store(true)
+	primary.pushes.Store(0)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	// One failed push and one failed replay open the circuit.
+	assert.Eventually(t, func() bool { return primary.pushes.Load() == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+	assert.Equal(t, int32(2), primary.pushes.Load())
+
+	primary.down.Store(false)
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 2 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestFailoverStoreReplaysAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fallback.db")
+	primary := &downStore{MemoryStore: store.NewMemoryStore()}
+	primary.down.Store(true)
+
+	fallback, err := store.NewBoltStore(path)
+	assert.NoError(t, err)
+	s := store.NewFailoverStore(primary, fallback)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+	assert.NoError(t, s.Close())
+	assert.NoError(t, fallback.Close())
+
+	primary.down.Store(false)
+	newFailoverStore(t, primary, newBoltStore(t, path))
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 2 }, 2*time.Second, 10*time.Millisecond)
+
+	task, err := primary.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
+
+func TestFailoverStoreHalfOpenSingleTrial(t *testing.T) {
+	primary := &downStore{MemoryStore: store.NewMemoryStore()}
+	fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+	s := newFailoverStore(t, primary, fallback, store.WithBreaker(1, 100*time.Millisecond))
+	time.Sleep(50 * time.Millisecond)
+
+	primary.down.Store(true)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	spilled, err := fallback.Pop()
+	assert.NoError(t, err)
+	assert.NoError(t, fallback.Ack(spilled))
+
+	// After the cooldown the replayer finds the fallback empty and stops
+	// spilling, leaving the circuit half-open.
+	time.Sleep(300 * time.Millisecond)
+	primary.gate = make(chan struct{})
+	primary.pushes.Store(0)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.Push(interfaces.Task{ID: fmt.Sprintf("task-%d", i+2), Name: "send_email"}))
+		}()
+	}
+	assert.Eventually(t, func() bool { return primary.pushes.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), primary.pushes.Load(), "more than one trial while half-open")
+
+	primary.down.Store(false)
+	close(primary.gate)
+	wg.Wait()
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 10 }, 2*time.Second, 10*time.Millisecond)
+}
+
+// brokenStore fails every pop while broken is set.
+type brokenStore struct {
+	*store.BoltStore
+	broken atomic.Bool
+}
+
+func (s *brokenStore) Pop() (interfaces.Task, error) {
+	if s.broken.Load() {
+		return interfaces.Task{}, errors.New("disk I/O error")
+	}
+	return s.BoltStore.Pop()
+}
+
+func (s *brokenStore) PopBatch(max int) ([]interfaces.Task, error) {
+	if s.broken.Load() {
+		return nil, errors.New("disk I/O error")
+	}
+	return s.BoltStore.PopBatch(max)
+}
+
+func TestFailoverStoreKeepsSpillingOnFallbackError(t *testing.T) {
+	primary := &downStore{MemoryStore: store.NewMemoryStore()}
+	fallback := &brokenStore{BoltStore: newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))}
+	fallback.broken.Store(true)
+	s := newFailoverStore(t, primary, fallback)
+
+	// Tasks left in the fallback may not have been replayed yet, so new
+	// tasks must not overtake them.
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, primary.LenQueue())
+
+	fallback.broken.Store(false)
+	assert.Eventually(t, func() bool { return primary.LenQueue() == 1 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestFailoverStoreForwardsOptionalInterfaces(t *testing.T) {
+	var _ interface {
+		interfaces.BatchPusher
+		interfaces.BatchPopper
+		interfaces.BatchAcker
+		interfaces.LeaseExtender
+		interfaces.PauseStore
+	} = (*store.FailoverStore)(nil)
+
+	primary := newBoltStore(t, filepath.Join(t.TempDir(), "primary.db"))
+	fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+	s := newFailoverStore(t, primary, fallback)
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, s.PushBatch([]interfaces.Task{{ID: "probe", Name: "send_email"}}))
+		tasks, err := primary.PopBatch(10)
+		assert.NoError(t, err)
+		assert.NoError(t, primary.AckBatch(tasks))
+		return len(tasks) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "task-1", Name: "send_email"},
+		{ID: "task-2", Name: "send_email"},
+	}))
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.NoError(t, s.ExtendLease(tasks[0], time.Minute))
+	assert.NoError(t, s.AckBatch(tasks))
+	_, err = primary.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.SetPaused("send_email", true))
+	names, err := primary.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"send_email"}, names)
+
+	// A primary that is not a PauseStore keeps pauses in memory.
+	plain := newFailoverStore(t, struct{ interfaces.TaskStore }{store.NewMemoryStore()}, fallback)
+	assert.NoError(t, plain.SetPaused("send_email", true))
+	names, err = plain.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"send_email"}, names)
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileStore(t *testing.T, dir string, opts ...store.FileOption) *store.FileStore {
+	s, err := store.NewFileStore(dir, opts...)
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestFileStoreNack(t *testing.T) {
+	testNack(t, newFileStore(t, t.TempDir()))
+}
+
+func TestFileStoreGroups(t *testing.T) {
+	testGroups(t, newFileStore(t, t.TempDir(), store.WithFsync(store.FsyncNever, 0)))
+}
+
+func TestFileStoreRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s := newFileStore(t, dir)
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "task-1", Name: "send_email"},
+		{ID: "task-2", Name: "send_email"},
+		{ID: "task-3", Name: "send_email", ScheduledAt: time.Now().Add(300 * time.Millisecond)},
+	}))
+	assert.NoError(t, s.SetPaused("report", true))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.NoError(t, s.Close())
+
+	s = newFileStore(t, dir)
+	names, err := s.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"report"}, names)
+
+	for _, id := range []string{"task-1", "task-2"} {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, id, task.ID)
+		assert.NoError(t, s.Ack(task))
+	}
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(400 * time.Millisecond)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-3", task.ID)
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s := newFileStore(t, dir, store.WithCompaction(10), store.WithFsync(store.FsyncInterval, 10*time.Millisecond))
+
+	for range 25 {
+		assert.NoError(t, s.Push(interfaces.Task{Name: "send_email"}))
+	}
+	for range 20 {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.NoError(t, s.Ack(task))
+	}
+	assert.NoError(t, s.Compact())
+
+	info, err := os.Stat(filepath.Join(dir, "wal"))
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size())
+	assert.NoError(t, s.Close())
+
+	s = newFileStore(t, dir)
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 5)
+}
+
+func TestFileStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := newFileStore(t, dir)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.NoError(t, s.Close())
+
+	wal, err := os.OpenFile(filepath.Join(dir, "wal"), os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = wal.Write([]byte{42, 0, 0, 0, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, wal.Close())
+
+	s = newFileStore(t, dir)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+	assert.NoError(t, s.Close())
+
+	s = newFileStore(t, dir)
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir := t.TempDir()
+	s := newFileStore(t, dir)
+
+	_, err := store.NewFileStore(dir)
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Close())
+	other, err := store.NewFileStore(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, other.Close())
+}
+
+func TestFileStoreCompactionFailureKeepsWrites(t *testing.T) {
+	dir := t.TempDir()
+	s := newFileStore(t, dir, store.WithCompaction(3))
+
+	// A directory in the way of the temporary snapshot makes compaction fail.
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "snapshot.tmp", "busy"), 0o755))
+	for range 5 {
+		assert.NoError(t, s.Push(interfaces.Task{Name: "send_email"}))
+	}
+	assert.NoError(t, s.Close())
+
+	s = newFileStore(t, dir)
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 5)
+}
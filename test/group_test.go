@@ -0,0 +1,238 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGroups(t *testing.T, s interfaces.TaskStore) {
+	grouped := func(id, group string) interfaces.Task {
+		return interfaces.Task{ID: id, Name: "sync_account", Payload: interfaces.Payload{"id": id}, GroupKey: group}
+	}
+	pop := func(expected string) interfaces.Task {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, task.ID)
+		return task
+	}
+
+	for _, task := range []interfaces.Task{
+		grouped("a1", "acct-a"),
+		grouped("a2", "acct-a"),
+		grouped("b1", "acct-b"),
+		grouped("c1", ""),
+		grouped("a3", "acct-a"),
+	} {
+		assert.NoError(t, s.Push(task))
+	}
+
+	a1 := pop("a1")
+	b1 := pop("b1")
+	pop("c1")
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Ack(a1))
+	assert.NoError(t, s.Ack(b1))
+	a2 := pop("a2")
+
+	assert.NoError(t, s.Nack(a2, 200*time.Millisecond))
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+	a2 = pop("a2")
+	assert.NoError(t, s.Ack(a2))
+
+	a3 := pop("a3")
+	assert.NoError(t, s.Nack(a3, 0))
+	a3 = pop("a3")
+	assert.NoError(t, s.Ack(a3))
+}
+
+func TestMemoryStoreGroups(t *testing.T) {
+	testGroups(t, gotsk.NewMemoryStore())
+	testGroups(t, store.NewMemoryStore())
+}
+
+func TestRedisStoreGroups(t *testing.T) {
+	mr := miniredis.RunT(t)
+	testGroups(t, store.NewRedisStore(mr.Addr(), "", 0, "gotsk"))
+	assert.False(t, mr.Exists("gotsk:group_locks"))
+}
+
+func TestQueueRunsOneTaskPerGroup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	queue := gotsk.NewWithStore(4, store.NewRedisStore(mr.Addr(), "", 0, "gotsk"))
+
+	var mu sync.Mutex
+	order := map[string][]float64{}
+	running, peak := map[string]int{}, map[string]int{}
+
+	queue.Register("sync_account", func(ctx context.Context, payload interfaces.Payload) error {
+		account := payload["account"].(string)
+
+		mu.Lock()
+		running[account]++
+		peak[account] = max(peak[account], running[account])
+		mu.Unlock()
+
+		time.Sleep(30 * time.Millisecond)
+
+		mu.Lock()
+		running[account]--
+		order[account] = append(order[account], payload["n"].(float64))
+		mu.Unlock()
+		return nil
+	})
+
+	for n := range 4 {
+		for _, account := range []string{"acct-1", "acct-2"} {
+			err := queue.EnqueueAt("sync_account", interfaces.Payload{"account": account, "n": n}, interfaces.TaskOptions{
+				GroupKey: account,
+			})
+			assert.NoError(t, err)
+		}
+	}
+
+	queue.Start()
+	time.Sleep(2 * time.Second)
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, account := range []string{"acct-1", "acct-2"} {
+		assert.Equal(t, []float64{0, 1, 2, 3}, order[account])
+		assert.Equal(t, 1, peak[account])
+	}
+}
+
+func TestPrefetchKeepsGroupOrder(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(4, memory, gotsk.WithPrefetch(10, 20, 0))
+
+	var mu sync.Mutex
+	order := map[string][]int{}
+	running := map[string]int{}
+	peak := map[string]int{}
+	total, totalPeak := 0, 0
+
+	queue.Register("sync_account", func(ctx context.Context, payload interfaces.Payload) error {
+		account := payload["account"].(string)
+
+		mu.Lock()
+		running[account]++
+		total++
+		peak[account] = max(peak[account], running[account])
+		totalPeak = max(totalPeak, total)
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		running[account]--
+		total--
+		order[account] = append(order[account], payload["n"].(int))
+		mu.Unlock()
+		return nil
+	})
+
+	for n := range 5 {
+		for _, account := range []string{"acct-1", "acct-2"} {
+			err := queue.EnqueueAt("sync_account", interfaces.Payload{"account": account, "n": n}, interfaces.TaskOptions{
+				GroupKey: account,
+			})
+			assert.NoError(t, err)
+		}
+	}
+
+	queue.Start()
+	time.Sleep(time.Second)
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, account := range []string{"acct-1", "acct-2"} {
+		assert.Equal(t, []int{0, 1, 2, 3, 4}, order[account], fmt.Sprintf("ordem do grupo %s", account))
+		assert.Equal(t, 1, peak[account])
+	}
+	assert.Equal(t, 2, totalPeak)
+}
+
+func TestQueueKeepsFailedGroupedTask(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(1, memory)
+
+	var attempts atomic.Int32
+	queue.Register("sync_account", func(ctx context.Context, payload interfaces.Payload) error {
+		attempts.Add(1)
+		return errors.New("account locked")
+	})
+	err := queue.EnqueueAt("sync_account", interfaces.Payload{"account": "acct-1"}, interfaces.TaskOptions{GroupKey: "acct-1"})
+	assert.NoError(t, err)
+
+	queue.Start()
+	assert.Eventually(t, func() bool { return attempts.Load() == 4 && memory.LenQueue() == 1 }, 10*time.Second, 10*time.Millisecond)
+	queue.Stop()
+
+	assert.Equal(t, 1, memory.LenQueue())
+	assert.Equal(t, 0, memory.LenPending())
+}
+
+func TestMemoryStoreAckUnlocksOwnGroup(t *testing.T) {
+	for _, s := range []interfaces.TaskStore{gotsk.NewMemoryStore(), store.NewMemoryStore()} {
+		same := interfaces.Payload{"account": "shared"}
+		for _, task := range []interfaces.Task{
+			{ID: "a1", Name: "sync_account", Payload: same, GroupKey: "acct-a"},
+			{ID: "b1", Name: "sync_account", Payload: same, GroupKey: "acct-b"},
+			{ID: "a2", Name: "sync_account", Payload: same, GroupKey: "acct-a"},
+		} {
+			assert.NoError(t, s.Push(task))
+		}
+
+		_, err := s.Pop()
+		assert.NoError(t, err)
+		b1, err := s.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, "b1", b1.ID)
+
+		assert.NoError(t, s.Ack(b1))
+		_, err = s.Pop()
+		assert.Error(t, err, "acking b1 must not unlock acct-a")
+	}
+}
+
+func TestRedisStoreGroupLockExpires(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStore(mr.Addr(), "", 0, "gotsk", store.WithGroupLockTTL(200*time.Millisecond))
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a1", Name: "sync_account", GroupKey: "acct-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a2", Name: "sync_account", GroupKey: "acct-a"}))
+
+	a1, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", a1.ID)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, s.ExtendLease(a1, 200*time.Millisecond))
+	time.Sleep(150 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	// The worker holding a1 crashed: the lock expires and a2 runs.
+	time.Sleep(150 * time.Millisecond)
+	a2, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "a2", a2.ID)
+}
@@ -0,0 +1,250 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeJetStream is an in-memory stream with a single pull consumer.
+type fakeJetStream struct {
+	mu       sync.Mutex
+	seq      uint64
+	ackWait  time.Duration
+	messages []*fakeJSMsg
+}
+
+type fakeJSMsg struct {
+	jetstream.Msg
+	js         *fakeJetStream
+	seq        uint64
+	data       []byte
+	visibleAt  time.Time
+	acked      bool
+	inProgress int
+}
+
+func (f *fakeJetStream) Publish(ctx context.Context, subject string, payload []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	f.messages = append(f.messages, &fakeJSMsg{js: f, seq: f.seq, data: payload})
+	return &jetstream.PubAck{Sequence: f.seq}, nil
+}
+
+func (f *fakeJetStream) FetchNoWait(batch int) (jetstream.MessageBatch, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	result := &fakeBatch{msgs: make(chan jetstream.Msg, batch)}
+	now := time.Now()
+	for _, m := range f.messages {
+		if len(result.msgs) == batch {
+			break
+		}
+		if m.acked || m.visibleAt.After(now) {
+			continue
+		}
+		m.visibleAt = now.Add(f.ackWait)
+		result.msgs <- m
+	}
+	close(result.msgs)
+	return result, nil
+}
+
+type fakeBatch struct {
+	msgs chan jetstream.Msg
+}
+
+func (b *fakeBatch) Messages() <-chan jetstream.Msg { return b.msgs }
+func (b *fakeBatch) Error() error                   { return nil }
+
+func (m *fakeJSMsg) Data() []byte { return m.data }
+
+func (m *fakeJSMsg) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{Sequence: jetstream.SequencePair{Stream: m.seq}}, nil
+}
+
+func (m *fakeJSMsg) Ack() error {
+	m.js.mu.Lock()
+	defer m.js.mu.Unlock()
+	m.acked = true
+	return nil
+}
+
+func (m *fakeJSMsg) Term() error { return m.Ack() }
+
+func (m *fakeJSMsg) Nak() error { return m.NakWithDelay(0) }
+
+func (m *fakeJSMsg) NakWithDelay(delay time.Duration) error {
+	m.js.mu.Lock()
+	defer m.js.mu.Unlock()
+	m.visibleAt = time.Now().Add(delay)
+	return nil
+}
+
+func (m *fakeJSMsg) InProgress() error {
+	m.js.mu.Lock()
+	defer m.js.mu.Unlock()
+	m.inProgress++
+	m.visibleAt = time.Now().Add(m.js.ackWait)
+	return nil
+}
+
+func newJetStreamStore(ackWait time.Duration) (*fakeJetStream, *store.JetStreamStore) {
+	js := &fakeJetStream{ackWait: ackWait}
+	return js, store.NewJetStreamStore(js, js, "tasks.default", store.WithJetStreamAckWait(ackWait))
+}
+
+func TestJetStreamStoreNack(t *testing.T) {
+	_, s := newJetStreamStore(time.Minute)
+	testNack(t, s)
+}
+
+func TestJetStreamStoreScheduledPush(t *testing.T) {
+	_, s := newJetStreamStore(time.Minute)
+
+	assert.NoError(t, s.Push(interfaces.Task{
+		ID:          "task-1",
+		Name:        "send_email",
+		ScheduledAt: time.Now().Add(300 * time.Millisecond),
+	}))
+
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(400 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.Equal(t, "1", task.ReceiptHandle)
+}
+
+func TestJetStreamStoreAckWait(t *testing.T) {
+	js, s := newJetStreamStore(200 * time.Millisecond)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+
+	time.Sleep(150 * time.Millisecond)
+	assert.NoError(t, s.ExtendLease(task, time.Minute))
+	assert.Equal(t, 1, js.messages[0].inProgress)
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	redelivered, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", redelivered.ID)
+	assert.NoError(t, s.Ack(redelivered))
+	assert.True(t, js.messages[0].acked)
+}
+
+func TestJetStreamStoreSkipsBadMessages(t *testing.T) {
+	js, s := newJetStreamStore(time.Minute)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	_, err := js.Publish(context.Background(), "tasks.default", []byte("{not json"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "task-1", tasks[0].ID)
+	assert.Equal(t, "task-2", tasks[1].ID)
+	assert.True(t, js.messages[1].acked)
+}
+
+func TestJetStreamStoreExpiresInflight(t *testing.T) {
+	js, s := newJetStreamStore(100 * time.Millisecond)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	stale, err := s.Pop()
+	assert.NoError(t, err)
+
+	// Past AckWait the message may be running elsewhere: the first fetch can
+	// no longer settle it.
+	time.Sleep(150 * time.Millisecond)
+	assert.EqualError(t, s.Ack(stale), "task not found in pending")
+	assert.Error(t, s.ExtendLease(stale, time.Minute))
+	assert.False(t, js.messages[0].acked)
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Ack(task))
+	assert.True(t, js.messages[0].acked)
+}
+
+// fakeJetStreamAPI serves durable consumers backed by one fakeJetStream,
+// taking AckWait from the consumer config.
+type fakeJetStreamAPI struct {
+	jetstream.JetStream
+	stream  *fakeJetStream
+	configs []jetstream.ConsumerConfig
+}
+
+type fakeConsumer struct {
+	jetstream.Consumer
+	stream *fakeJetStream
+}
+
+func (c *fakeConsumer) FetchNoWait(batch int) (jetstream.MessageBatch, error) {
+	return c.stream.FetchNoWait(batch)
+}
+
+func (f *fakeJetStreamAPI) Publish(ctx context.Context, subject string, payload []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	return f.stream.Publish(ctx, subject, payload, opts...)
+}
+
+func (f *fakeJetStreamAPI) CreateOrUpdateConsumer(ctx context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	f.configs = append(f.configs, cfg)
+	f.stream.mu.Lock()
+	f.stream.ackWait = cfg.AckWait
+	f.stream.mu.Unlock()
+	return &fakeConsumer{stream: f.stream}, nil
+}
+
+func TestDurableJetStreamStoreRedelivers(t *testing.T) {
+	js := &fakeJetStreamAPI{stream: &fakeJetStream{}}
+	ctx := context.Background()
+
+	crashed, err := store.NewDurableJetStreamStore(ctx, js, "TASKS", "tasks.default", "workers", 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, jetstream.ConsumerConfig{
+		Durable:       "workers",
+		FilterSubject: "tasks.default",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       200 * time.Millisecond,
+		MaxDeliver:    -1,
+	}, js.configs[0])
+
+	assert.NoError(t, crashed.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	_, err = crashed.Pop()
+	assert.NoError(t, err)
+
+	// A second process joins the durable consumer; the task left unacked by
+	// the first one is redelivered once AckWait expires.
+	s, err := store.NewDurableJetStreamStore(ctx, js, "TASKS", "tasks.default", "workers", 200*time.Millisecond)
+	assert.NoError(t, err)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(250 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.NoError(t, s.Ack(task))
+
+	time.Sleep(250 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+}
@@ -0,0 +1,377 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKafka is an in-memory cluster with a single consumer group. Records are
+// partitioned by key hash; records without a key go to partition 0.
+type fakeKafka struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string][][]store.KafkaMessage
+	committed  map[string]map[int]int64
+	signal     chan struct{}
+}
+
+// fakeKafkaConsumer reads every partition from the group's committed position.
+type fakeKafkaConsumer struct {
+	kafka    *fakeKafka
+	topics   []string
+	position map[string]map[int]int64
+}
+
+func newFakeKafka(partitions int) *fakeKafka {
+	return &fakeKafka{
+		partitions: partitions,
+		topics:     make(map[string][][]store.KafkaMessage),
+		committed:  make(map[string]map[int]int64),
+		signal:     make(chan struct{}),
+	}
+}
+
+func (k *fakeKafka) Produce(ctx context.Context, msgs ...store.KafkaMessage) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, msg := range msgs {
+		if _, ok := k.topics[msg.Topic]; !ok {
+			k.topics[msg.Topic] = make([][]store.KafkaMessage, k.partitions)
+		}
+		if len(msg.Key) > 0 {
+			h := fnv.New32a()
+			h.Write(msg.Key)
+			msg.Partition = int(h.Sum32() % uint32(k.partitions))
+		}
+		log := k.topics[msg.Topic][msg.Partition]
+		msg.Offset = int64(len(log))
+		k.topics[msg.Topic][msg.Partition] = append(log, msg)
+	}
+	close(k.signal)
+	k.signal = make(chan struct{})
+	return nil
+}
+
+func (k *fakeKafka) consumer(topics ...string) *fakeKafkaConsumer {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	position := make(map[string]map[int]int64)
+	for _, topic := range topics {
+		position[topic] = make(map[int]int64)
+		for p, offset := range k.committed[topic] {
+			position[topic][p] = offset
+		}
+	}
+	return &fakeKafkaConsumer{kafka: k, topics: topics, position: position}
+}
+
+func (k *fakeKafka) committedOffset(topic string, partition int) int64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.committed[topic][partition]
+}
+
+func (c *fakeKafkaConsumer) Fetch(ctx context.Context) (store.KafkaMessage, error) {
+	for {
+		c.kafka.mu.Lock()
+		for _, topic := range c.topics {
+			for p, log := range c.kafka.topics[topic] {
+				if offset := c.position[topic][p]; offset < int64(len(log)) {
+					c.position[topic][p] = offset + 1
+					c.kafka.mu.Unlock()
+					return log[offset], nil
+				}
+			}
+		}
+		signal := c.kafka.signal
+		c.kafka.mu.Unlock()
+
+		select {
+		case <-signal:
+		case <-ctx.Done():
+			return store.KafkaMessage{}, ctx.Err()
+		}
+	}
+}
+
+func (c *fakeKafkaConsumer) Commit(ctx context.Context, msgs ...store.KafkaMessage) error {
+	c.kafka.mu.Lock()
+	defer c.kafka.mu.Unlock()
+
+	for _, msg := range msgs {
+		if _, ok := c.kafka.committed[msg.Topic]; !ok {
+			c.kafka.committed[msg.Topic] = make(map[int]int64)
+		}
+		c.kafka.committed[msg.Topic][msg.Partition] = msg.Offset + 1
+	}
+	return nil
+}
+
+func (k *fakeKafka) records(topic string) []store.KafkaMessage {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var msgs []store.KafkaMessage
+	for _, log := range k.topics[topic] {
+		msgs = append(msgs, log...)
+	}
+	return msgs
+}
+
+func newKafkaStore(t *testing.T, kafka *fakeKafka, opts ...store.KafkaOption) *store.KafkaStore {
+	s := store.NewKafkaStore(kafka, kafka.consumer("tasks", "tasks.retry"), "tasks", opts...)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func popKafka(t *testing.T, s *store.KafkaStore, n int) []interfaces.Task {
+	var tasks []interfaces.Task
+	assert.Eventually(t, func() bool {
+		batch, err := s.PopBatch(n - len(tasks))
+		assert.NoError(t, err)
+		tasks = append(tasks, batch...)
+		return len(tasks) == n
+	}, time.Second, 10*time.Millisecond)
+	return tasks
+}
+
+func TestKafkaStoreContiguousCommits(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka)
+
+	for _, id := range []string{"task-1", "task-2", "task-3"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "send_email"}))
+	}
+	tasks := popKafka(t, s, 3)
+
+	assert.NoError(t, s.Ack(tasks[2]))
+	assert.Equal(t, int64(0), kafka.committedOffset("tasks", 0))
+
+	assert.NoError(t, s.Ack(tasks[0]))
+	assert.Equal(t, int64(1), kafka.committedOffset("tasks", 0))
+
+	assert.NoError(t, s.Ack(tasks[1]))
+	assert.Equal(t, int64(3), kafka.committedOffset("tasks", 0))
+
+	assert.Error(t, s.Ack(tasks[1]))
+}
+
+func TestKafkaStoreRedeliversUncommitted(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+	tasks := popKafka(t, s, 2)
+	assert.NoError(t, s.Ack(tasks[1]))
+	assert.NoError(t, s.Close())
+
+	restarted := newKafkaStore(t, kafka)
+	tasks = popKafka(t, restarted, 2)
+	assert.Equal(t, "task-1", tasks[0].ID)
+	assert.Equal(t, "task-2", tasks[1].ID)
+}
+
+func TestKafkaStoreRetryTopic(t *testing.T) {
+	kafka := newFakeKafka(2)
+	s := newKafkaStore(t, kafka)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task := popKafka(t, s, 1)[0]
+
+	assert.NoError(t, s.Nack(task, 300*time.Millisecond))
+	assert.Equal(t, int64(1), kafka.committedOffset("tasks", 0))
+	assert.Len(t, kafka.topics["tasks.retry"][0], 1)
+
+	time.Sleep(100 * time.Millisecond)
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.NoError(t, s.Ack(task))
+	assert.Equal(t, int64(1), kafka.committedOffset("tasks.retry", 0))
+}
+
+func TestKafkaStoreGroups(t *testing.T) {
+	kafka := newFakeKafka(4)
+	s := newKafkaStore(t, kafka)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-1", Name: "sync", GroupKey: "account-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-2", Name: "sync", GroupKey: "account-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "b-1", Name: "sync", GroupKey: "account-b"}))
+
+	tasks := popKafka(t, s, 2)
+	ids := []string{tasks[0].ID, tasks[1].ID}
+	assert.ElementsMatch(t, []string{"a-1", "b-1"}, ids)
+
+	first := tasks[0]
+	if first.ID != "a-1" {
+		first = tasks[1]
+	}
+	assert.NoError(t, s.Nack(first, 200*time.Millisecond))
+
+	time.Sleep(100 * time.Millisecond)
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	retried := popKafka(t, s, 1)[0]
+	assert.Equal(t, "a-1", retried.ID)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Ack(retried))
+	assert.Equal(t, "a-2", popKafka(t, s, 1)[0].ID)
+}
+
+func TestKafkaStoreDeadLetter(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka)
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-1", Name: "sync", GroupKey: "account-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-2", Name: "sync", GroupKey: "account-a"}))
+	task := popKafka(t, s, 1)[0]
+	assert.Equal(t, "a-1", task.ID)
+
+	assert.NoError(t, s.DeadLetter(task))
+	assert.Equal(t, int64(1), kafka.committedOffset("tasks", 0))
+	dead := kafka.records("tasks.dead")
+	assert.Len(t, dead, 1)
+	var deadTask interfaces.Task
+	assert.NoError(t, json.Unmarshal(dead[0].Value, &deadTask))
+	assert.Equal(t, "a-1", deadTask.ID)
+	assert.Equal(t, []byte("account-a"), dead[0].Key)
+
+	next := popKafka(t, s, 1)[0]
+	assert.Equal(t, "a-2", next.ID)
+	assert.NoError(t, s.Ack(next))
+	assert.Equal(t, int64(2), kafka.committedOffset("tasks", 0))
+	assert.Error(t, s.DeadLetter(task))
+}
+
+func TestKafkaStoreBufferCountsPending(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka, store.WithKafkaBuffer(2))
+
+	for _, id := range []string{"task-1", "task-2", "task-3", "task-4"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "send_email"}))
+	}
+	tasks := popKafka(t, s, 2)
+
+	time.Sleep(200 * time.Millisecond)
+	batch, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Empty(t, batch, "fetched past the buffer while tasks were pending")
+
+	assert.NoError(t, s.Ack(tasks[0]))
+	assert.Equal(t, "task-3", popKafka(t, s, 1)[0].ID)
+}
+
+func TestKafkaStoreBufferFetchesRetriedOwner(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka, store.WithKafkaBuffer(2))
+
+	for _, id := range []string{"a-1", "a-2", "a-3"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "sync", GroupKey: "account-a"}))
+	}
+	task := popKafka(t, s, 1)[0]
+	assert.NoError(t, s.Nack(task, 100*time.Millisecond))
+
+	// a-2 and a-3 fill the buffer, but a-1 must still come back from the
+	// retry topic to release the group.
+	var ids []string
+	for range 3 {
+		task := popKafka(t, s, 1)[0]
+		ids = append(ids, task.ID)
+		assert.NoError(t, s.Ack(task))
+	}
+	assert.Equal(t, []string{"a-1", "a-2", "a-3"}, ids)
+}
+
+func TestKafkaStoreBufferSkipsDelayed(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka, store.WithKafkaBuffer(2))
+
+	for _, id := range []string{"later-1", "later-2", "later-3"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "report", ScheduledAt: time.Now().Add(time.Hour)}))
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.Equal(t, "task-1", popKafka(t, s, 1)[0].ID)
+}
+
+// revokingConsumer lets a test revoke partitions like a rebalance would.
+type revokingConsumer struct {
+	*fakeKafkaConsumer
+	revoke func(map[string][]int)
+}
+
+func (c *revokingConsumer) OnRevoke(fn func(map[string][]int)) {
+	c.revoke = fn
+}
+
+func TestKafkaStoreDropsRevokedPartitions(t *testing.T) {
+	kafka := newFakeKafka(1)
+	consumer := &revokingConsumer{fakeKafkaConsumer: kafka.consumer("tasks", "tasks.retry")}
+	s := store.NewKafkaStore(kafka, consumer, "tasks")
+	t.Cleanup(func() { s.Close() })
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-1", Name: "sync", GroupKey: "account-a"}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+	tasks := popKafka(t, s, 2)
+
+	consumer.revoke(map[string][]int{"tasks": {0}})
+	assert.Error(t, s.Ack(tasks[0]))
+	assert.Error(t, s.Ack(tasks[1]))
+
+	// The partition comes back later; its commits are not held back by the
+	// records that were dropped, and the group is not locked.
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-3", Name: "sync", GroupKey: "account-a"}))
+	task := popKafka(t, s, 1)[0]
+	assert.Equal(t, "a-3", task.ID)
+	assert.NoError(t, s.Ack(task))
+	assert.Equal(t, int64(3), kafka.committedOffset("tasks", 0))
+}
+
+func TestQueueDeadLettersFailedKafkaTask(t *testing.T) {
+	kafka := newFakeKafka(1)
+	s := newKafkaStore(t, kafka)
+
+	queue := gotsk.NewWithStore(1, s)
+	done := make(chan struct{})
+	queue.Register("sync", func(ctx context.Context, payload interfaces.Payload) error {
+		if payload["n"] == "1" {
+			return errors.New("account locked")
+		}
+		close(done)
+		return nil
+	})
+	for _, n := range []string{"1", "2"} {
+		err := queue.EnqueueAt("sync", interfaces.Payload{"n": n}, interfaces.TaskOptions{GroupKey: "account-a"})
+		assert.NoError(t, err)
+	}
+
+	queue.Start()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("group stayed locked behind the failed task")
+	}
+	queue.Stop()
+
+	assert.Len(t, kafka.records("tasks.dead"), 1)
+	assert.Eventually(t, func() bool { return kafka.committedOffset("tasks", 0) == 2 }, time.Second, 10*time.Millisecond)
+}
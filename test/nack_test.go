@@ -0,0 +1,67 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNack(t *testing.T, s interfaces.TaskStore) {
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email", Payload: interfaces.Payload{"key": "a"}}))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Nack(task, 0))
+
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+
+	assert.NoError(t, s.Nack(task, 300*time.Millisecond))
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(400 * time.Millisecond)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.NoError(t, s.Ack(task))
+
+	assert.Error(t, s.Nack(task, 0))
+}
+
+func TestMemoryStoreNack(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	testNack(t, memory)
+	assert.Equal(t, 0, memory.LenQueue())
+	assert.Equal(t, 0, memory.LenPending())
+}
+
+func TestRedisStoreNack(t *testing.T) {
+	mr := miniredis.RunT(t)
+	testNack(t, store.NewRedisStore(mr.Addr(), "", 0, "gotsk"))
+}
+
+func TestRedisStoreScheduledPush(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+
+	assert.NoError(t, s.Push(interfaces.Task{
+		ID:          "task-1",
+		Name:        "send_email",
+		ScheduledAt: time.Now().Add(300 * time.Millisecond),
+	}))
+
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(400 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func newNamedQueues(strategy gotsk.PollStrategy) (*gotsk.Queue, *[]string, *sync.Mutex) {
+	queue := gotsk.NewWithQueues(1, []gotsk.NamedQueue{
+		{Name: "critical", Store: gotsk.NewMemoryStore(), Weight: 6},
+		{Name: "default", Store: gotsk.NewMemoryStore(), Weight: 3},
+		{Name: "low", Store: gotsk.NewMemoryStore(), Weight: 1},
+	}, gotsk.WithPollStrategy(strategy))
+
+	var mu sync.Mutex
+	var processed []string
+	queue.Register("test_task", func(ctx context.Context, payload interfaces.Payload) error {
+		mu.Lock()
+		processed = append(processed, payload["queue"].(string))
+		mu.Unlock()
+		return nil
+	})
+
+	return queue, &processed, &mu
+}
+
+func TestStrictPriorityQueues(t *testing.T) {
+	queue, processed, mu := newNamedQueues(gotsk.StrictPriority)
+
+	for _, name := range []string{"low", "default", "critical"} {
+		for range 3 {
+			assert.NoError(t, queue.EnqueueTo(name, "test_task", interfaces.Payload{"queue": name}))
+		}
+	}
+
+	queue.Start()
+	time.Sleep(500 * time.Millisecond)
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"critical", "critical", "critical",
+		"default", "default", "default",
+		"low", "low", "low",
+	}, *processed)
+}
+
+func TestWeightedQueues(t *testing.T) {
+	queue, processed, mu := newNamedQueues(gotsk.WeightedPolling)
+
+	for range 20 {
+		assert.NoError(t, queue.EnqueueTo("critical", "test_task", interfaces.Payload{"queue": "critical"}))
+		assert.NoError(t, queue.EnqueueTo("low", "test_task", interfaces.Payload{"queue": "low"}))
+	}
+
+	queue.Start()
+	time.Sleep(time.Second)
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, *processed, 40)
+
+	counts := map[string]int{}
+	for _, name := range (*processed)[:14] {
+		counts[name]++
+	}
+	assert.Greater(t, counts["critical"], counts["low"])
+}
+
+func TestEnqueueToUnknownQueue(t *testing.T) {
+	queue, _, _ := newNamedQueues(gotsk.StrictPriority)
+
+	err := queue.EnqueueTo("missing", "test_task", interfaces.Payload{"queue": "missing"})
+	assert.Error(t, err)
+
+	err = queue.EnqueueAt("test_task", interfaces.Payload{"queue": "low"}, interfaces.TaskOptions{Queue: "low"})
+	assert.NoError(t, err)
+}
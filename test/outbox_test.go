@@ -0,0 +1,248 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/outbox"
+	"github.com/Thauan/gotsk/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOutbox(t *testing.T) (*sql.DB, *outbox.Outbox) {
+	dsn := filepath.Join(t.TempDir(), "app.db") + "?_journal_mode=WAL&_busy_timeout=5000"
+	db, err := sql.Open("sqlite3", dsn)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	o := outbox.New(db, store.SQLite)
+	assert.NoError(t, o.Migrate(context.Background()))
+	return db, o
+}
+
+func addToOutbox(t *testing.T, db *sql.DB, o *outbox.Outbox, commit bool, payloads ...interfaces.Payload) {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	for _, payload := range payloads {
+		_, err := o.Add(ctx, tx, "send_email", payload, interfaces.TaskOptions{})
+		assert.NoError(t, err)
+	}
+	if commit {
+		assert.NoError(t, tx.Commit())
+	} else {
+		assert.NoError(t, tx.Rollback())
+	}
+}
+
+// flakyStore fails the first pushes.
+type flakyStore struct {
+	*gotsk.MemoryStore
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakyStore) Push(task interfaces.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("store unavailable")
+	}
+	return s.MemoryStore.Push(task)
+}
+
+func (s *flakyStore) PushBatch(tasks []interfaces.Task) error {
+	result := &interfaces.BatchError{Errors: make([]error, len(tasks))}
+	for i, task := range tasks {
+		result.Errors[i] = s.Push(task)
+	}
+	if result.Failed() {
+		return result
+	}
+	return nil
+}
+
+func TestOutboxRelaysCommittedTasks(t *testing.T) {
+	db, o := newOutbox(t)
+	memory := gotsk.NewMemoryStore()
+	relay := outbox.NewRelay(o, memory)
+
+	addToOutbox(t, db, o, false, interfaces.Payload{"to": "a@example.com"})
+	addToOutbox(t, db, o, true, interfaces.Payload{"to": "b@example.com"}, interfaces.Payload{"to": "c@example.com"})
+
+	n, err := relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, memory.LenQueue())
+
+	n, err = relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	var dispatched int
+	assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM gotsk_outbox WHERE dispatched_at IS NOT NULL`).Scan(&dispatched))
+	assert.Equal(t, 2, dispatched)
+}
+
+func TestOutboxRetriesFailedPush(t *testing.T) {
+	db, o := newOutbox(t)
+	target := &flakyStore{MemoryStore: gotsk.NewMemoryStore(), failures: 1}
+	relay := outbox.NewRelay(o, target, outbox.WithClaimTimeout(100*time.Millisecond))
+
+	addToOutbox(t, db, o, true, interfaces.Payload{"to": "a@example.com"})
+
+	n, err := relay.RelayOnce(context.Background())
+	assert.Error(t, err)
+	assert.Zero(t, n)
+
+	n, err = relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	time.Sleep(150 * time.Millisecond)
+	n, err = relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, target.LenQueue())
+}
+
+func TestOutboxConcurrentRelays(t *testing.T) {
+	db, o := newOutbox(t)
+	memory := gotsk.NewMemoryStore()
+
+	payloads := make([]interfaces.Payload, 200)
+	for i := range payloads {
+		payloads[i] = interfaces.Payload{"n": i}
+	}
+	addToOutbox(t, db, o, true, payloads...)
+
+	var relays []*outbox.Relay
+	for range 4 {
+		relay := outbox.NewRelay(o, memory, outbox.WithBatchSize(10), outbox.WithPollInterval(10*time.Millisecond))
+		relay.Start()
+		relays = append(relays, relay)
+	}
+
+	assert.Eventually(t, func() bool { return memory.LenQueue() >= 200 }, 5*time.Second, 20*time.Millisecond)
+	for _, relay := range relays {
+		relay.Stop()
+	}
+
+	seen := map[string]bool{}
+	for range 200 {
+		task, err := memory.Pop()
+		assert.NoError(t, err)
+		assert.False(t, seen[task.ID], task.ID)
+		seen[task.ID] = true
+	}
+	_, err := memory.Pop()
+	assert.Error(t, err)
+}
+
+func TestOutboxMarksMalformedRowFailed(t *testing.T) {
+	db, o := newOutbox(t)
+	memory := gotsk.NewMemoryStore()
+	relay := outbox.NewRelay(o, memory, outbox.WithClaimTimeout(50*time.Millisecond))
+
+	addToOutbox(t, db, o, true, interfaces.Payload{"to": "a@example.com"})
+	_, err := db.Exec(`INSERT INTO gotsk_outbox (id, data, created_at) VALUES ('bad', '{not json', 0)`)
+	assert.NoError(t, err)
+	addToOutbox(t, db, o, true, interfaces.Payload{"to": "b@example.com"})
+
+	n, err := relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, memory.LenQueue())
+
+	var dispatched, failed sql.NullInt64
+	assert.NoError(t, db.QueryRow(`SELECT dispatched_at, failed_at FROM gotsk_outbox WHERE id = 'bad'`).Scan(&dispatched, &failed))
+	assert.False(t, dispatched.Valid)
+	assert.True(t, failed.Valid)
+
+	// The failed row is not claimed again once its lease expires.
+	time.Sleep(100 * time.Millisecond)
+	var locked int64
+	assert.NoError(t, db.QueryRow(`SELECT locked_until FROM gotsk_outbox WHERE id = 'bad'`).Scan(&locked))
+	n, err = relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	var relocked int64
+	assert.NoError(t, db.QueryRow(`SELECT locked_until FROM gotsk_outbox WHERE id = 'bad'`).Scan(&relocked))
+	assert.Equal(t, locked, relocked)
+}
+
+// shuffledDriver answers the claim query with its rows out of seq order, as
+// RETURNING is allowed to, and accepts every other statement.
+type shuffledDriver struct {
+	rows [][]driver.Value
+}
+
+func (d *shuffledDriver) Open(string) (driver.Conn, error) { return shuffledConn{d}, nil }
+
+type shuffledConn struct{ d *shuffledDriver }
+
+func (c shuffledConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c shuffledConn) Close() error                        { return nil }
+func (c shuffledConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c shuffledConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (c shuffledConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &shuffledRows{rows: c.d.rows}, nil
+}
+
+type shuffledRows struct {
+	rows [][]driver.Value
+}
+
+func (r *shuffledRows) Columns() []string { return []string{"seq", "data"} }
+func (r *shuffledRows) Close() error      { return nil }
+
+func (r *shuffledRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestOutboxRelaysInSeqOrder(t *testing.T) {
+	d := &shuffledDriver{}
+	for _, seq := range []int64{3, 1, 4, 2} {
+		data, err := json.Marshal(interfaces.Task{ID: fmt.Sprintf("task-%d", seq), Name: "sync", GroupKey: "account-1"})
+		assert.NoError(t, err)
+		d.rows = append(d.rows, []driver.Value{seq, string(data)})
+	}
+	sql.Register("gotsk-shuffled", d)
+	db, err := sql.Open("gotsk-shuffled", "")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	memory := gotsk.NewMemoryStore()
+	relay := outbox.NewRelay(outbox.New(db, store.Postgres), memory, outbox.WithRetention(0))
+	n, err := relay.RelayOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	for _, want := range []string{"task-1", "task-2", "task-3", "task-4"} {
+		task, err := memory.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, want, task.ID)
+		assert.NoError(t, memory.Ack(task))
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseResume(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(2, memory)
+
+	var processed int32
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+
+	assert.NoError(t, queue.Pause("send_email"))
+	for range 2 {
+		assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"key": "email"}))
+	}
+
+	queue.Start()
+	defer queue.Stop()
+
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&processed))
+	assert.Equal(t, 2, memory.LenQueue())
+
+	assert.NoError(t, queue.Resume("send_email"))
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&processed))
+}
+
+func TestPauseIsSharedThroughStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store1 := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+	store2 := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+
+	queue1 := gotsk.NewWithStore(1, store1)
+	queue2 := gotsk.NewWithStore(1, store2)
+
+	var processed int32
+	queue2.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+
+	assert.NoError(t, queue1.PauseAll())
+	names, err := store2.PausedNames()
+	assert.NoError(t, err)
+	assert.Contains(t, names, "*")
+
+	assert.NoError(t, queue2.Enqueue("send_email", interfaces.Payload{"key": "email"}))
+	queue2.Start()
+	defer queue2.Stop()
+
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&processed))
+
+	assert.NoError(t, queue1.ResumeAll())
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&processed))
+}
+
+func TestDrain(t *testing.T) {
+	memory := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(2, memory)
+
+	var processed int32
+	queue.Register("generate_pdf", func(ctx context.Context, payload interfaces.Payload) error {
+		time.Sleep(300 * time.Millisecond)
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+
+	assert.NoError(t, queue.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	queue.Start()
+	defer queue.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.NoError(t, queue.Drain(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&processed))
+
+	assert.NoError(t, queue.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	time.Sleep(700 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&processed))
+	assert.Equal(t, 1, memory.LenQueue())
+
+	assert.NoError(t, queue.ResumeAll())
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&processed))
+}
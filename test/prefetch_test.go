@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type leaseStore struct {
+	*gotsk.MemoryStore
+	mu       sync.Mutex
+	extended map[string]int
+}
+
+func (s *leaseStore) ExtendLease(task interfaces.Task, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extended[task.ID]++
+	return nil
+}
+
+func TestPrefetch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisStore := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+	queue := gotsk.NewWithStore(2, redisStore, gotsk.WithPrefetch(10, 20, 0))
+
+	var processed int32
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+
+	for range 50 {
+		assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"key": "email"}))
+	}
+
+	queue.Start()
+	time.Sleep(time.Second)
+	report := queue.Stop()
+
+	assert.NoError(t, report.Err)
+	assert.Equal(t, int32(50), atomic.LoadInt32(&processed))
+}
+
+func TestPrefetchReleasesBufferedTasksOnStop(t *testing.T) {
+	memory := &leaseStore{MemoryStore: gotsk.NewMemoryStore(), extended: map[string]int{}}
+	queue := gotsk.NewWithStore(1, memory, gotsk.WithPrefetch(5, 5, 300*time.Millisecond))
+
+	var processed int32
+	queue.Register("generate_pdf", func(ctx context.Context, payload interfaces.Payload) error {
+		time.Sleep(time.Second)
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+
+	for range 5 {
+		assert.NoError(t, queue.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	}
+
+	queue.Start()
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, 0, memory.LenQueue())
+
+	report := queue.Stop()
+
+	assert.NoError(t, report.Err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&processed))
+	assert.Equal(t, 4, memory.LenQueue())
+	assert.Equal(t, 0, memory.LenPending())
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	assert.Len(t, memory.extended, 4)
+}
+
+func TestRedisStorePopBatch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+
+	for _, id := range []string{"task-1", "task-2", "task-3"} {
+		assert.NoError(t, s.Push(interfaces.Task{ID: id, Name: "send_email"}))
+	}
+
+	tasks, err := s.PopBatch(2)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "task-1", tasks[0].ID)
+	assert.Equal(t, "task-2", tasks[1].ID)
+
+	tasks, err = s.PopBatch(2)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	tasks, err = s.PopBatch(2)
+	assert.NoError(t, err)
+	assert.Empty(t, tasks)
+}
@@ -3,6 +3,7 @@ package test
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -69,7 +70,12 @@ func TestFailedTask(t *testing.T) {
 	store := gotsk.NewMemoryStore()
 	queue := gotsk.NewWithStore(2, store)
 
+	var attempts atomic.Int32
+	lastAttempt := make(chan struct{})
 	queue.Register("fail_task", func(ctx context.Context, payload interfaces.Payload) error {
+		if attempts.Add(1) == 4 {
+			close(lastAttempt)
+		}
 		return fmt.Errorf("task intentionally failed")
 	})
 
@@ -77,7 +83,11 @@ func TestFailedTask(t *testing.T) {
 	assert.NoError(t, err)
 
 	queue.Start()
-	time.Sleep(5 * time.Second)
+	select {
+	case <-lastAttempt:
+	case <-time.After(10 * time.Second):
+		t.Fatal("task was not retried")
+	}
 	queue.Stop()
 
 	assert.Equal(t, 0, store.LenQueue())
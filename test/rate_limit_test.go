@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/limiter"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	store := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(4, store)
+
+	var mu sync.Mutex
+	var runs []time.Time
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		mu.Lock()
+		runs = append(runs, time.Now())
+		mu.Unlock()
+		return nil
+	}, gotsk.RateLimit(limiter.NewTokenBucket(4, 1)))
+
+	for range 4 {
+		assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"key": "email"}))
+	}
+
+	queue.Start()
+	time.Sleep(4 * time.Second)
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, runs, 4)
+	assert.Equal(t, 0, store.LenQueue())
+	assert.Equal(t, 0, store.LenPending())
+	for i := 1; i < len(runs); i++ {
+		assert.GreaterOrEqual(t, runs[i].Sub(runs[i-1]), 200*time.Millisecond)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l := limiter.NewTokenBucket(10, 2)
+	ctx := context.Background()
+
+	for range 2 {
+		wait, err := l.Reserve(ctx, "send_email")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	wait, err := l.Reserve(ctx, "send_email")
+	assert.NoError(t, err)
+	assert.Greater(t, wait, time.Duration(0))
+	assert.LessOrEqual(t, wait, 100*time.Millisecond)
+
+	wait, err = l.Reserve(ctx, "other_task")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestRedisTokenBucket(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	l := limiter.NewRedisTokenBucket(client, "gotsk", 10, 2)
+	ctx := context.Background()
+
+	for range 2 {
+		wait, err := l.Reserve(ctx, "send_email")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	wait, err := l.Reserve(ctx, "send_email")
+	assert.NoError(t, err)
+	assert.Greater(t, wait, time.Duration(0))
+
+	time.Sleep(wait)
+	wait, err = l.Reserve(ctx, "send_email")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestRedisSlidingWindow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	l := limiter.NewRedisSlidingWindow(client, "gotsk", 2, 300*time.Millisecond)
+	ctx := context.Background()
+
+	for range 2 {
+		wait, err := l.Reserve(ctx, "send_email")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	wait, err := l.Reserve(ctx, "send_email")
+	assert.NoError(t, err)
+	assert.Greater(t, wait, time.Duration(0))
+	assert.LessOrEqual(t, wait, 300*time.Millisecond)
+
+	time.Sleep(wait)
+	wait, err = l.Reserve(ctx, "send_email")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestRedisRateLimitersUseRedisClock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	now := time.Now()
+	mr.SetTime(now)
+
+	bucket := limiter.NewRedisTokenBucket(client, "gotsk", 10, 1)
+	window := limiter.NewRedisSlidingWindow(client, "gotsk", 1, 300*time.Millisecond)
+	for _, l := range []interfaces.RateLimiter{bucket, window} {
+		wait, err := l.Reserve(ctx, "send_email")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+
+		// The local clock moves on, but the Redis one does not.
+		time.Sleep(350 * time.Millisecond)
+		wait, err = l.Reserve(ctx, "send_email")
+		assert.NoError(t, err)
+		assert.Greater(t, wait, time.Duration(0))
+	}
+
+	mr.SetTime(now.Add(time.Second))
+	for _, l := range []interfaces.RateLimiter{bucket, window} {
+		wait, err := l.Reserve(ctx, "send_email")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+}
+
+func TestRateLimitersRejectInvalidLimits(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	for _, l := range []interfaces.RateLimiter{
+		limiter.NewTokenBucket(0, 1),
+		limiter.NewRedisTokenBucket(client, "gotsk", -1, 1),
+		limiter.NewRedisSlidingWindow(client, "gotsk", 0, time.Second),
+		limiter.NewRedisSlidingWindow(client, "gotsk", 1, 0),
+	} {
+		_, err := l.Reserve(ctx, "send_email")
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSentinel answers SENTINEL get-master-addr-by-name with a master that
+// the test can switch.
+type fakeSentinel struct {
+	mu     sync.Mutex
+	master *miniredis.Miniredis
+	srv    *server.Server
+}
+
+func newFakeSentinel(t *testing.T, master *miniredis.Miniredis) *fakeSentinel {
+	srv, err := server.NewServer("127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	f := &fakeSentinel{master: master, srv: srv}
+	srv.Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		if len(args) == 0 || !strings.EqualFold(args[0], "get-master-addr-by-name") {
+			c.WriteLen(0)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		c.WriteStrings([]string{f.master.Host(), f.master.Port()})
+	})
+	srv.Register("PING", func(c *server.Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	return f
+}
+
+func (f *fakeSentinel) failover(master *miniredis.Miniredis) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.master = master
+}
+
+func TestRedisStoreSentinelFailover(t *testing.T) {
+	primary := miniredis.RunT(t)
+	replica := miniredis.RunT(t)
+	sentinel := newFakeSentinel(t, primary)
+
+	s := store.NewRedisStoreWithOptions(&redis.UniversalOptions{
+		Addrs:      []string{sentinel.srv.Addr().String()},
+		MasterName: "mymaster",
+	}, "gotsk")
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.True(t, primary.Exists("{gotsk}:queue"))
+
+	sentinel.failover(replica)
+	primary.Close()
+
+	assert.Eventually(t, func() bool {
+		return s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-2", task.ID)
+}
+
+func TestRedisStoreClusterClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() { client.Close() })
+
+	s := store.NewRedisStoreWithClient(client, "gotsk")
+	testNack(t, s)
+	testGroups(t, s)
+	assert.NoError(t, s.SetPaused("send_email", true))
+
+	for _, key := range mr.Keys() {
+		assert.True(t, strings.HasPrefix(key, "{gotsk}:"), key)
+	}
+}
+
+func TestRedisStoreReconnects(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := store.NewRedisStoreWithOptions(&redis.UniversalOptions{
+		Addrs:      []string{mr.Addr()},
+		MaxRetries: -1,
+	}, "{tenant-1}:tasks")
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	assert.True(t, mr.Exists("{tenant-1}:tasks:queue"))
+
+	mr.Close()
+	_, err := s.Pop()
+	assert.Error(t, err)
+	assert.Error(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email"}))
+
+	assert.NoError(t, mr.Restart())
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.NoError(t, s.Ack(task))
+}
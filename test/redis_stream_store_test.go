@@ -0,0 +1,163 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStreamClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestRedisStreamStoreNack(t *testing.T) {
+	_, client := newStreamClient(t)
+	testNack(t, store.NewRedisStreamStore(client, "tasks"))
+}
+
+func TestRedisStreamStorePopBatch(t *testing.T) {
+	mr, client := newStreamClient(t)
+	s := store.NewRedisStreamStore(client, "tasks")
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "task-1", Name: "send_email"},
+		{ID: "task-2", Name: "send_email"},
+		{ID: "task-3", Name: "send_email", ScheduledAt: time.Now().Add(time.Hour)},
+	}))
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "task-1", tasks[0].ID)
+	assert.NotEmpty(t, tasks[0].ReceiptHandle)
+
+	assert.NoError(t, s.AckBatch(tasks))
+	assert.NoError(t, s.ExtendLease(tasks[0], time.Minute))
+
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	entries, err := mr.Stream("{tasks}:stream")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRedisStreamStoreClaimsIdleTasks(t *testing.T) {
+	_, client := newStreamClient(t)
+	crashed := store.NewRedisStreamStore(client, "tasks",
+		store.WithConsumerGroup("workers", "worker-1"), store.WithClaimIdle(200*time.Millisecond))
+	alive := store.NewRedisStreamStore(client, "tasks",
+		store.WithConsumerGroup("workers", "worker-2"), store.WithClaimIdle(200*time.Millisecond))
+
+	assert.NoError(t, crashed.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	task, err := crashed.Pop()
+	assert.NoError(t, err)
+
+	_, err = alive.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+	claimed, err := alive.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", claimed.ID)
+	assert.Equal(t, task.ReceiptHandle, claimed.ReceiptHandle)
+	assert.NoError(t, alive.Ack(claimed))
+}
+
+func TestRedisStreamStoreMaxLenKeepsUnackedTasks(t *testing.T) {
+	mr, client := newStreamClient(t)
+	s := store.NewRedisStreamStore(client, "tasks", store.WithMaxLen(5))
+
+	for i := range 20 {
+		assert.NoError(t, s.Push(interfaces.Task{ID: fmt.Sprintf("task-%d", i), Name: "send_email"}))
+	}
+	streamLen := func() int {
+		entries, err := mr.Stream("{tasks}:stream")
+		assert.NoError(t, err)
+		return len(entries)
+	}
+	assert.Equal(t, 20, streamLen())
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 10)
+
+	// The two oldest tasks are still pending, so nothing can be trimmed.
+	assert.NoError(t, s.AckBatch(tasks[2:]))
+	assert.Equal(t, 20, streamLen())
+
+	// Acked history is trimmed, but unread tasks are kept.
+	assert.NoError(t, s.AckBatch(tasks[:2]))
+	assert.Equal(t, 10, streamLen())
+
+	rest, err := s.PopBatch(20)
+	assert.NoError(t, err)
+	assert.Len(t, rest, 10)
+	for i, task := range rest {
+		assert.Equal(t, fmt.Sprintf("task-%d", i+10), task.ID)
+		assert.NoError(t, s.Ack(task))
+	}
+	assert.Equal(t, 5, streamLen())
+}
+
+func TestRedisStreamStoreDropsMalformedEntries(t *testing.T) {
+	mr, client := newStreamClient(t)
+	s := store.NewRedisStreamStore(client, "tasks", store.WithClaimIdle(time.Millisecond))
+
+	ctx := context.Background()
+	assert.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: "{tasks}:stream", Values: map[string]any{"other": "x"}}).Err())
+	assert.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: "{tasks}:stream", Values: map[string]any{"task": "{"}}).Err())
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "task-1", tasks[0].ID)
+
+	time.Sleep(10 * time.Millisecond)
+	tasks, err = s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "task-1", tasks[0].ID)
+
+	entries, err := mr.Stream("{tasks}:stream")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRedisStreamStoreQueue(t *testing.T) {
+	_, client := newStreamClient(t)
+	queue := gotsk.NewWithStore(2, store.NewRedisStreamStore(client, "tasks"))
+
+	var mu sync.Mutex
+	var received []string
+	queue.Register("send_email", func(ctx context.Context, payload interfaces.Payload) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, payload["to"].(string))
+		return nil
+	})
+
+	queue.Start()
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"to": "a@example.com"}))
+	assert.NoError(t, queue.Enqueue("send_email", interfaces.Payload{"to": "b@example.com"}))
+	time.Sleep(1500 * time.Millisecond)
+	queue.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"a@example.com", "b@example.com"}, received)
+}
@@ -0,0 +1,343 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func newShards(n int) ([]*store.MemoryStore, []interfaces.TaskStore) {
+	memories := make([]*store.MemoryStore, n)
+	shards := make([]interfaces.TaskStore, n)
+	for i := range n {
+		memories[i] = store.NewMemoryStore()
+		shards[i] = memories[i]
+	}
+	return memories, shards
+}
+
+func shardTask(id, group string) interfaces.Task {
+	return interfaces.Task{ID: id, Name: "sync", GroupKey: group, Payload: interfaces.Payload{"id": id}}
+}
+
+// drainShards pops and acks every task and returns the IDs found on each
+// shard, in the order they came out.
+func drainShards(t *testing.T, memories []*store.MemoryStore) [][]string {
+	t.Helper()
+	ids := make([][]string, len(memories))
+	for i, m := range memories {
+		for {
+			task, err := m.Pop()
+			if err != nil {
+				break
+			}
+			ids[i] = append(ids[i], task.ID)
+			assert.NoError(t, m.Ack(task))
+		}
+	}
+	return ids
+}
+
+// assertGroupsSticky checks that every task of a group is on one shard, in
+// push order.
+func assertGroupsSticky(t *testing.T, ids [][]string, groups, tasks int) {
+	t.Helper()
+	for g := range groups {
+		group := fmt.Sprintf("account-%d", g)
+		holders := 0
+		for _, shard := range ids {
+			var got []string
+			for _, id := range shard {
+				if strings.HasPrefix(id, group+"-") {
+					got = append(got, id)
+				}
+			}
+			if len(got) == 0 {
+				continue
+			}
+			holders++
+			var want []string
+			for j := range tasks {
+				want = append(want, fmt.Sprintf("%s-%d", group, j))
+			}
+			assert.Equal(t, want, got)
+		}
+		assert.Equal(t, 1, holders, "group %s on %d shards", group, holders)
+	}
+}
+
+func TestShardedStoreConsistentHashing(t *testing.T) {
+	memories, shards := newShards(3)
+	s := store.NewShardedStore(shards)
+
+	for i := range 60 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("task-%d", i), "")))
+	}
+	for _, m := range memories {
+		assert.Greater(t, m.LenQueue(), 5)
+	}
+
+	drainShards(t, memories)
+
+	for j := range 3 {
+		for g := range 10 {
+			assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-%d", g, j), fmt.Sprintf("account-%d", g))))
+		}
+	}
+	assertGroupsSticky(t, drainShards(t, memories), 10, 3)
+}
+
+func TestShardedStoreRoundRobin(t *testing.T) {
+	memories, shards := newShards(3)
+	s := store.NewShardedStore(shards, store.WithRoundRobin())
+
+	for i := range 6 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("task-%d", i), "")))
+	}
+	for _, m := range memories {
+		assert.Equal(t, 2, m.LenQueue())
+	}
+}
+
+func TestShardedStoreFairPop(t *testing.T) {
+	memories, shards := newShards(2)
+	s := store.NewShardedStore(shards)
+
+	for i := range 3 {
+		assert.NoError(t, memories[0].Push(shardTask(fmt.Sprintf("a-%d", i), "")))
+		assert.NoError(t, memories[1].Push(shardTask(fmt.Sprintf("b-%d", i), "")))
+	}
+
+	var ids []string
+	for range 6 {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		ids = append(ids, task.ID)
+		assert.NoError(t, s.Ack(task))
+	}
+	assert.Equal(t, []string{"a-0", "b-0", "a-1", "b-1", "a-2", "b-2"}, ids)
+	assert.Equal(t, 0, memories[0].LenPending())
+	assert.Equal(t, 0, memories[1].LenPending())
+
+	_, err := s.Pop()
+	assert.Error(t, err)
+	assert.Error(t, s.Ack(interfaces.Task{ID: "a-0", ReceiptHandle: "7/"}))
+}
+
+func TestShardedStoreAddShardRebalances(t *testing.T) {
+	memories, shards := newShards(2)
+	s := store.NewShardedStore(shards)
+
+	for i := range 40 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("task-%d", i), "")))
+	}
+	for j := range 4 {
+		for g := range 5 {
+			assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-%d", g, j), fmt.Sprintf("account-%d", g))))
+		}
+	}
+
+	added := store.NewMemoryStore()
+	assert.NoError(t, s.AddShard(added))
+	memories = append(memories, added)
+
+	assert.Greater(t, added.LenQueue(), 0)
+	assert.Equal(t, 60, memories[0].LenQueue()+memories[1].LenQueue()+added.LenQueue())
+
+	// New tasks of a group land on the shard holding its queued tasks.
+	for g := range 5 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-4", g), fmt.Sprintf("account-%d", g))))
+	}
+	assertGroupsSticky(t, drainShards(t, memories), 5, 5)
+}
+
+func TestShardedStoreAddShardPinsGroupInFlight(t *testing.T) {
+	memories, shards := newShards(2)
+	s := store.NewShardedStore(shards)
+
+	for g := range 10 {
+		group := fmt.Sprintf("account-%d", g)
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("running-%d", g), group)))
+		assert.NoError(t, s.Push(shardTask(group+"-0", group)))
+	}
+	var running []interfaces.Task
+	for range 10 {
+		task, err := s.Pop()
+		assert.NoError(t, err)
+		running = append(running, task)
+	}
+
+	added := store.NewMemoryStore()
+	assert.NoError(t, s.AddShard(added))
+	memories = append(memories, added)
+
+	// While a group runs, its new tasks queue behind the ones on its old shard.
+	for g := range 10 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-1", g), fmt.Sprintf("account-%d", g))))
+	}
+	assert.Equal(t, 0, added.LenQueue())
+
+	// Once it is done, the group moves to the new shard as a whole.
+	for _, task := range running {
+		assert.NoError(t, s.Ack(task))
+	}
+	assert.Greater(t, added.LenQueue(), 0)
+	for g := range 10 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-2", g), fmt.Sprintf("account-%d", g))))
+	}
+	assertGroupsSticky(t, drainShards(t, memories), 10, 3)
+}
+
+func TestShardedStoreAddShardKeepsDeliveries(t *testing.T) {
+	opts := []store.BoltOption{store.WithBoltLease(100 * time.Millisecond), store.WithMaxDeliveries(2)}
+	bolts := []*store.BoltStore{
+		newBoltStore(t, filepath.Join(t.TempDir(), "a.db"), opts...),
+		newBoltStore(t, filepath.Join(t.TempDir(), "b.db"), opts...),
+	}
+	s := store.NewShardedStore([]interfaces.TaskStore{bolts[0], bolts[1]})
+	for i := range 30 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("task-%d", i), "")))
+	}
+
+	added := store.NewMemoryStore()
+	assert.NoError(t, s.AddShard(added))
+	assert.Greater(t, added.LenQueue(), 0)
+
+	// AddShard did not deliver the tasks left on their shard, so one expired
+	// lease does not kill them.
+	for _, b := range bolts {
+		kept := 0
+		for {
+			if _, err := b.Pop(); err != nil {
+				break
+			}
+			kept++
+		}
+		time.Sleep(150 * time.Millisecond)
+
+		redelivered := 0
+		for {
+			task, err := b.Pop()
+			if err != nil {
+				break
+			}
+			assert.NoError(t, b.Ack(task))
+			redelivered++
+		}
+		assert.Equal(t, kept, redelivered)
+		dead, err := b.DeadTasks()
+		assert.NoError(t, err)
+		assert.Empty(t, dead)
+	}
+}
+
+func TestShardedStoreAddShardKeepsGroupsOnPlainShards(t *testing.T) {
+	memories, _ := newShards(2)
+	shards := []interfaces.TaskStore{
+		struct{ interfaces.TaskStore }{memories[0]},
+		struct{ interfaces.TaskStore }{memories[1]},
+	}
+	s := store.NewShardedStore(shards)
+	for j := range 2 {
+		for g := range 10 {
+			assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-%d", g, j), fmt.Sprintf("account-%d", g))))
+		}
+	}
+
+	added := store.NewMemoryStore()
+	assert.NoError(t, s.AddShard(added))
+	memories = append(memories, added)
+	assert.Equal(t, 20, memories[0].LenQueue()+memories[1].LenQueue())
+
+	// Shards that cannot hand over their tasks keep their groups.
+	for g := range 10 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-2", g), fmt.Sprintf("account-%d", g))))
+	}
+	assert.Equal(t, 0, added.LenQueue())
+	assertGroupsSticky(t, drainShards(t, memories), 10, 3)
+}
+
+// failingTaker is a MemoryStore whose tasks cannot be taken.
+type failingTaker struct {
+	*store.MemoryStore
+}
+
+func (failingTaker) Take(func(interfaces.Task) bool) ([]interfaces.Task, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestShardedStoreAddShardReportsTakeError(t *testing.T) {
+	memories, _ := newShards(2)
+	s := store.NewShardedStore([]interfaces.TaskStore{failingTaker{memories[0]}, failingTaker{memories[1]}})
+	for j := range 2 {
+		for g := range 10 {
+			assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-%d", g, j), fmt.Sprintf("account-%d", g))))
+		}
+	}
+
+	added := store.NewMemoryStore()
+	err := s.AddShard(added)
+	assert.ErrorContains(t, err, "failed to take tasks from shard 0: connection refused")
+	assert.ErrorContains(t, err, "failed to take tasks from shard 1: connection refused")
+	memories = append(memories, added)
+
+	// The groups stay with the tasks that could not be moved.
+	for g := range 10 {
+		assert.NoError(t, s.Push(shardTask(fmt.Sprintf("account-%d-2", g), fmt.Sprintf("account-%d", g))))
+	}
+	assert.Equal(t, 0, added.LenQueue())
+	assertGroupsSticky(t, drainShards(t, memories), 10, 3)
+}
+
+func TestShardedStoreForwardsOptionalInterfaces(t *testing.T) {
+	var _ interface {
+		interfaces.BatchPusher
+		interfaces.BatchPopper
+		interfaces.BatchAcker
+		interfaces.LeaseExtender
+		interfaces.PauseStore
+	} = (*store.ShardedStore)(nil)
+
+	memories, shards := newShards(2)
+	s := store.NewShardedStore(shards, store.WithRoundRobin())
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		shardTask("task-1", ""),
+		shardTask("task-2", ""),
+		shardTask("task-3", ""),
+	}))
+	assert.Equal(t, 2, memories[0].LenQueue())
+	assert.Equal(t, 1, memories[1].LenQueue())
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 3)
+	assert.NoError(t, s.ExtendLease(tasks[0], time.Minute))
+	assert.NoError(t, s.AckBatch(tasks))
+	assert.Equal(t, 0, memories[0].LenPending())
+	assert.Equal(t, 0, memories[1].LenPending())
+
+	assert.NoError(t, s.SetPaused("sync", true))
+	for _, m := range memories {
+		names, err := m.PausedNames()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"sync"}, names)
+	}
+	names, err := s.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sync"}, names)
+
+	// Shards that are not PauseStores keep pauses in memory.
+	plain := store.NewShardedStore([]interfaces.TaskStore{struct{ interfaces.TaskStore }{store.NewMemoryStore()}})
+	assert.NoError(t, plain.SetPaused("sync", true))
+	names, err = plain.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sync"}, names)
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopWaitsForInFlightTasks(t *testing.T) {
+	store := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(1, store, gotsk.WithShutdownTimeout(2*time.Second))
+
+	var finished int32
+	queue.Register("generate_pdf", func(ctx context.Context, payload interfaces.Payload) error {
+		select {
+		case <-time.After(500 * time.Millisecond):
+			atomic.AddInt32(&finished, 1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	assert.NoError(t, queue.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	queue.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	report := queue.Stop()
+
+	assert.Empty(t, report.Interrupted)
+	assert.NoError(t, report.Err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+	assert.Equal(t, 0, store.LenQueue())
+	assert.Equal(t, 0, store.LenPending())
+}
+
+func TestStopRequeuesTasksAfterDeadline(t *testing.T) {
+	store := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(1, store, gotsk.WithShutdownTimeout(200*time.Millisecond))
+
+	queue.Register("generate_pdf", func(ctx context.Context, payload interfaces.Payload) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.NoError(t, queue.Enqueue("generate_pdf", interfaces.Payload{"key": "pdf"}))
+	queue.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	report := queue.Stop()
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, report.Interrupted, 1)
+	assert.Equal(t, "generate_pdf", report.Interrupted[0].Name)
+	assert.NoError(t, report.Err)
+	assert.Equal(t, 1, store.LenQueue())
+	assert.Equal(t, 0, store.LenPending())
+}
+
+func TestStopDoesNotWaitForBackoff(t *testing.T) {
+	store := gotsk.NewMemoryStore()
+	queue := gotsk.NewWithStore(1, store)
+
+	queue.Register("fail_task", func(ctx context.Context, payload interfaces.Payload) error {
+		return fmt.Errorf("task intentionally failed")
+	})
+
+	assert.NoError(t, queue.Enqueue("fail_task", interfaces.Payload{"key": "test"}))
+	queue.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	report := queue.Stop()
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Len(t, report.Interrupted, 1)
+	assert.Equal(t, 1, store.LenQueue())
+	assert.Equal(t, 0, store.LenPending())
+}
@@ -0,0 +1,267 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSQLStore(t *testing.T, opts ...store.SQLOption) (*sql.DB, *store.SQLStore) {
+	dsn := filepath.Join(t.TempDir(), "gotsk.db") + "?_journal_mode=WAL&_busy_timeout=5000"
+	db, err := sql.Open("sqlite3", dsn)
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s := store.NewSQLStore(db, store.SQLite, opts...)
+	assert.NoError(t, s.Migrate(context.Background()))
+	return db, s
+}
+
+func TestSQLStoreNack(t *testing.T) {
+	_, s := newSQLStore(t)
+	testNack(t, s)
+}
+
+func TestSQLStoreMigrateTwice(t *testing.T) {
+	_, s := newSQLStore(t)
+	assert.NoError(t, s.Migrate(context.Background()))
+}
+
+func TestSQLStorePriorityAndSchedule(t *testing.T) {
+	_, s := newSQLStore(t)
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "low", Name: "send_email"},
+		{ID: "high", Name: "send_email", Priority: 10},
+		{ID: "later", Name: "send_email", Priority: 20, ScheduledAt: time.Now().Add(time.Hour)},
+		{ID: "low-2", Name: "send_email"},
+	}))
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	assert.Equal(t, []string{"high", "low", "low-2"}, ids)
+	assert.NoError(t, s.AckBatch(tasks))
+}
+
+func TestSQLStoreEnqueueTx(t *testing.T) {
+	db, s := newSQLStore(t)
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	_, err = s.EnqueueTx(ctx, tx, "send_email", interfaces.Payload{"to": "a@example.com"}, interfaces.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	tx, err = db.BeginTx(ctx, nil)
+	assert.NoError(t, err)
+	enqueued, err := s.EnqueueTx(ctx, tx, "send_email", interfaces.Payload{"to": "b@example.com"}, interfaces.TaskOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, enqueued.ID, task.ID)
+	assert.Equal(t, "b@example.com", task.Payload["to"])
+}
+
+func TestSQLStoreLeaseExpires(t *testing.T) {
+	_, s := newSQLStore(t, store.WithLease(200*time.Millisecond))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.ExtendLease(task, 400*time.Millisecond))
+	time.Sleep(250 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(250 * time.Millisecond)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
+
+func TestSQLStoreConcurrentPop(t *testing.T) {
+	_, s := newSQLStore(t)
+
+	tasks := make([]interfaces.Task, 100)
+	for i := range tasks {
+		tasks[i] = interfaces.Task{Name: "send_email"}
+	}
+	assert.NoError(t, s.PushBatch(tasks))
+
+	var mu sync.Mutex
+	seen := map[string]int{}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				batch, err := s.PopBatch(5)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(batch) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, task := range batch {
+					seen[task.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 100)
+	for id, n := range seen {
+		assert.Equal(t, 1, n, id)
+	}
+}
+
+func TestSQLStorePause(t *testing.T) {
+	_, s := newSQLStore(t)
+	assert.NoError(t, s.SetPaused("send_email", true))
+	assert.NoError(t, s.SetPaused("send_email", true))
+
+	names, err := s.PausedNames()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"send_email"}, names)
+
+	assert.NoError(t, s.SetPaused("send_email", false))
+	names, err = s.PausedNames()
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestSQLStoreStaleClaim(t *testing.T) {
+	_, s := newSQLStore(t, store.WithLease(100*time.Millisecond))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	stale, err := s.Pop()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stale.ReceiptHandle)
+
+	time.Sleep(150 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.NotEqual(t, stale.ReceiptHandle, task.ReceiptHandle)
+
+	// The first worker's lease expired: it can no longer settle the task.
+	assert.EqualError(t, s.Ack(stale), "task not found in pending")
+	assert.Error(t, s.Nack(stale, 0))
+	assert.Error(t, s.ExtendLease(stale, time.Minute))
+
+	assert.NoError(t, s.Nack(task, 0))
+	assert.Error(t, s.Nack(task, 0))
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	err = s.AckBatch([]interfaces.Task{stale, task})
+	var batchErr *interfaces.BatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.EqualError(t, batchErr.Errors[0], "task not found in pending")
+	assert.NoError(t, batchErr.Errors[1])
+
+	_, err = s.Pop()
+	assert.Error(t, err)
+}
+
+// recordingDriver keeps the statements it is given and answers every query
+// with no rows, so the SQL built for a dialect can be checked without a server.
+type recordingDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{d}, nil }
+
+func (d *recordingDriver) record(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, query)
+}
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *recordingConn) Close() error                        { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c *recordingConn) Commit() error                       { return nil }
+func (c *recordingConn) Rollback() error                     { return nil }
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.d.record(query)
+	return recordingRows{}, nil
+}
+
+type recordingRows struct{}
+
+func (recordingRows) Columns() []string         { return []string{"seq", "priority", "data"} }
+func (recordingRows) Close() error              { return nil }
+func (recordingRows) Next([]driver.Value) error { return io.EOF }
+
+var (
+	recorder         = &recordingDriver{}
+	registerRecorder sync.Once
+)
+
+func TestSQLStorePostgresDialect(t *testing.T) {
+	registerRecorder.Do(func() { sql.Register("gotsk-recording", recorder) })
+	recorder.queries = nil
+	db, err := sql.Open("gotsk-recording", "")
+	assert.NoError(t, err)
+	defer db.Close()
+	d := recorder
+
+	s := store.NewSQLStore(db, store.Postgres)
+	_, err = s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Ack(interfaces.Task{ID: "task-1", ReceiptHandle: "claim"}))
+	// The recorder returns no rows, so no task is reported deleted.
+	assert.Error(t, s.AckBatch([]interfaces.Task{{ID: "task-1"}, {ID: "task-2"}}))
+	assert.NoError(t, s.Nack(interfaces.Task{ID: "task-1"}, 0))
+	assert.NoError(t, s.SetPaused("send_email", true))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	assert.Len(t, d.queries, 5)
+	for _, query := range d.queries {
+		assert.NotContains(t, query, "?")
+	}
+	assert.Contains(t, d.queries[0], "SET available_at = $1, claim = $2")
+	assert.Contains(t, d.queries[0], "WHERE available_at <= $3 ORDER BY priority DESC, seq LIMIT $4 FOR UPDATE SKIP LOCKED")
+	assert.Contains(t, d.queries[1], "WHERE id = $1 AND claim = $2")
+	assert.Contains(t, d.queries[2], "(id = $1 AND claim = $2) OR (id = $3 AND claim = $4) RETURNING id, claim")
+	assert.Contains(t, d.queries[3], "SET available_at = $1, claim = $2 WHERE id = $3 AND claim = $4")
+	assert.True(t, strings.HasSuffix(d.queries[4], "VALUES ($1) ON CONFLICT DO NOTHING"))
+}
@@ -0,0 +1,253 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/store"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSQS struct {
+	mu       sync.Mutex
+	seq      int
+	messages []*fakeMessage
+}
+
+type fakeMessage struct {
+	id        string
+	body      string
+	attrs     map[string]types.MessageAttributeValue
+	visibleAt time.Time
+	receipt   string
+	delay     int32
+	groupID   string
+	dedupID   string
+}
+
+func (f *fakeSQS) send(body string, attrs map[string]types.MessageAttributeValue, delay int32) *fakeMessage {
+	f.seq++
+	m := &fakeMessage{
+		id:        fmt.Sprintf("msg-%d", f.seq),
+		body:      body,
+		attrs:     attrs,
+		delay:     delay,
+		visibleAt: time.Now().Add(time.Duration(delay) * time.Second),
+	}
+	f.messages = append(f.messages, m)
+	return m
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := f.send(*in.MessageBody, in.MessageAttributes, in.DelaySeconds)
+	m.groupID, m.dedupID = aws.ToString(in.MessageGroupId), aws.ToString(in.MessageDeduplicationId)
+	return &sqs.SendMessageOutput{MessageId: &m.id}, nil
+}
+
+func (f *fakeSQS) SendMessageBatch(ctx context.Context, in *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range in.Entries {
+		m := f.send(*entry.MessageBody, entry.MessageAttributes, entry.DelaySeconds)
+		m.groupID, m.dedupID = aws.ToString(entry.MessageGroupId), aws.ToString(entry.MessageDeduplicationId)
+		out.Successful = append(out.Successful, types.SendMessageBatchResultEntry{Id: entry.Id, MessageId: &m.id})
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := &sqs.ReceiveMessageOutput{}
+	now := time.Now()
+	for _, m := range f.messages {
+		if len(out.Messages) == int(in.MaxNumberOfMessages) {
+			break
+		}
+		if m.visibleAt.After(now) {
+			continue
+		}
+		f.seq++
+		m.receipt = fmt.Sprintf("receipt-%d", f.seq)
+		m.visibleAt = now.Add(30 * time.Second)
+		out.Messages = append(out.Messages, types.Message{
+			MessageId:         aws.String(m.id),
+			Body:              aws.String(m.body),
+			ReceiptHandle:     aws.String(m.receipt),
+			MessageAttributes: m.attrs,
+			Attributes:        map[string]string{"MessageGroupId": m.groupID},
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) find(receipt string) (int, error) {
+	for i, m := range f.messages {
+		if m.receipt == receipt {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("receipt handle %s is invalid", receipt)
+}
+
+func (f *fakeSQS) DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := f.find(*in.ReceiptHandle)
+	if err != nil {
+		return nil, err
+	}
+	f.messages = append(f.messages[:i], f.messages[i+1:]...)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessageBatch(ctx context.Context, in *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	out := &sqs.DeleteMessageBatchOutput{}
+	for _, entry := range in.Entries {
+		if _, err := f.DeleteMessage(ctx, &sqs.DeleteMessageInput{ReceiptHandle: entry.ReceiptHandle}); err != nil {
+			out.Failed = append(out.Failed, types.BatchResultErrorEntry{Id: entry.Id, Message: aws.String(err.Error())})
+			continue
+		}
+		out.Successful = append(out.Successful, types.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+	return out, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(ctx context.Context, in *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := f.find(*in.ReceiptHandle)
+	if err != nil {
+		return nil, err
+	}
+	f.messages[i].visibleAt = time.Now().Add(time.Duration(in.VisibilityTimeout) * time.Second)
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func TestSQSStorePreservesTaskFields(t *testing.T) {
+	client := &fakeSQS{}
+	s := store.NewSQSStore(client, "queue")
+
+	scheduledAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond)
+	assert.NoError(t, s.Push(interfaces.Task{
+		ID:          "task-1",
+		Name:        "send_email",
+		Payload:     interfaces.Payload{"to": "user@example.com"},
+		Priority:    5,
+		ScheduledAt: scheduledAt,
+	}))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+	assert.Equal(t, "send_email", task.Name)
+	assert.Equal(t, "user@example.com", task.Payload["to"])
+	assert.Equal(t, 5, task.Priority)
+	assert.True(t, scheduledAt.Equal(task.ScheduledAt))
+	assert.NotEmpty(t, task.ReceiptHandle)
+
+	attrs := client.messages[0].attrs
+	assert.Equal(t, "task-1", *attrs["gotsk.id"].StringValue)
+	assert.Equal(t, "send_email", *attrs["gotsk.name"].StringValue)
+	assert.Equal(t, "5", *attrs["gotsk.priority"].StringValue)
+
+	assert.NoError(t, s.Ack(task))
+	assert.Empty(t, client.messages)
+}
+
+func TestSQSStoreReadsLegacyFormats(t *testing.T) {
+	client := &fakeSQS{}
+	s := store.NewSQSStore(client, "queue")
+
+	client.send(`{"Name":"send_email","Payload":{"to":"a@example.com"}}`, nil, 0)
+	client.send(`{"id":"task-2","name":"send_email","payload":{"to":"b@example.com"},"retries":0,"priority":1,"scheduled_at":"0001-01-01T00:00:00Z"}`, nil, 0)
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	assert.Equal(t, "msg-1", tasks[0].ID)
+	assert.Equal(t, "send_email", tasks[0].Name)
+	assert.Equal(t, "a@example.com", tasks[0].Payload["to"])
+
+	assert.Equal(t, "task-2", tasks[1].ID)
+	assert.Equal(t, 1, tasks[1].Priority)
+	assert.Equal(t, "b@example.com", tasks[1].Payload["to"])
+
+	assert.NoError(t, s.AckBatch(tasks))
+	assert.Empty(t, client.messages)
+}
+
+func TestSQSStoreScheduledAt(t *testing.T) {
+	client := &fakeSQS{}
+	s := store.NewSQSStore(client, "queue")
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email", ScheduledAt: time.Now().Add(2 * time.Minute)}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-2", Name: "send_email", ScheduledAt: time.Now().Add(time.Hour)}))
+
+	assert.Equal(t, int32(120), client.messages[0].delay)
+	assert.Equal(t, int32(900), client.messages[1].delay)
+
+	client.messages[1].visibleAt = time.Now()
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	assert.Len(t, client.messages, 2)
+	assert.NotEqual(t, "msg-2", client.messages[1].id)
+	assert.Equal(t, int32(900), client.messages[1].delay)
+}
+
+func TestSQSStoreNack(t *testing.T) {
+	client := &fakeSQS{}
+	s := store.NewSQSStore(client, "queue")
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	task, err := s.Pop()
+	assert.NoError(t, err)
+
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.Nack(task, 0))
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
+
+func TestSQSStoreFIFO(t *testing.T) {
+	client := &fakeSQS{}
+	s := store.NewSQSStore(client, "queue.fifo", store.WithFIFO("account_id"))
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "sync", Payload: interfaces.Payload{"account_id": 42}}))
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "task-2", Name: "sync", GroupKey: "customer-7", UniqueKey: "sync-7"},
+		{ID: "task-3", Name: "sync", ScheduledAt: time.Now().Add(time.Hour)},
+	}))
+
+	assert.Equal(t, "42", client.messages[0].groupID)
+	assert.Equal(t, "task-1", client.messages[0].dedupID)
+	assert.Equal(t, "customer-7", client.messages[1].groupID)
+	assert.Equal(t, "sync-7", client.messages[1].dedupID)
+	assert.Equal(t, "sync", client.messages[2].groupID)
+	assert.Equal(t, int32(0), client.messages[2].delay)
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "42", tasks[0].GroupKey)
+	assert.Equal(t, "customer-7", tasks[1].GroupKey)
+
+	assert.Len(t, client.messages, 3)
+	assert.True(t, client.messages[2].visibleAt.After(time.Now().Add(50*time.Minute)))
+}
@@ -0,0 +1,198 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/sqstest"
+	"github.com/Thauan/gotsk/store"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSQSServer(t *testing.T) *sqstest.Server {
+	srv := sqstest.NewServer(sqstest.WithMaxWait(50 * time.Millisecond))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSQSServerStoreRoundTrip(t *testing.T) {
+	srv := newSQSServer(t)
+	s := store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks"))
+
+	var tasks []interfaces.Task
+	for _, id := range []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"} {
+		tasks = append(tasks, interfaces.Task{ID: "task-" + id, Name: "send_email", Priority: 2, Payload: interfaces.Payload{"to": id}})
+	}
+	assert.NoError(t, s.PushBatch(tasks))
+
+	popped, err := s.PopBatch(20)
+	assert.NoError(t, err)
+	assert.Len(t, popped, 10)
+	assert.Equal(t, "task-1", popped[0].ID)
+	assert.Equal(t, "send_email", popped[0].Name)
+	assert.Equal(t, 2, popped[0].Priority)
+	assert.Equal(t, "1", popped[0].Payload["to"])
+
+	assert.NoError(t, s.AckBatch(popped))
+	assert.Error(t, s.Ack(popped[0]))
+
+	rest, err := s.PopBatch(20)
+	assert.NoError(t, err)
+	assert.Len(t, rest, 2)
+}
+
+func TestSQSServerVisibility(t *testing.T) {
+	srv := newSQSServer(t)
+	s := store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks", sqstest.WithVisibilityTimeout(time.Second)))
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task, err := s.Pop()
+	assert.NoError(t, err)
+
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	assert.NoError(t, s.ExtendLease(task, 2*time.Second))
+	time.Sleep(1200 * time.Millisecond)
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(time.Second)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+
+	assert.NoError(t, s.Nack(task, 0))
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
+
+func TestSQSServerFIFO(t *testing.T) {
+	srv := newSQSServer(t)
+	s := store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks.fifo"), store.WithFIFO(""))
+
+	assert.NoError(t, s.PushBatch([]interfaces.Task{
+		{ID: "a-1", Name: "sync", GroupKey: "account-a"},
+		{ID: "a-2", Name: "sync", GroupKey: "account-a"},
+		{ID: "b-1", Name: "sync", GroupKey: "account-b"},
+	}))
+	assert.NoError(t, s.Push(interfaces.Task{ID: "a-1", Name: "sync", GroupKey: "account-a"}))
+
+	first, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "a-1", first.ID)
+	assert.Equal(t, "account-a", first.GroupKey)
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "b-1", tasks[0].ID)
+
+	assert.NoError(t, s.Ack(first))
+	assert.NoError(t, s.Ack(tasks[0]))
+
+	next, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "a-2", next.ID)
+	assert.NoError(t, s.Ack(next))
+
+	_, err = s.Pop()
+	assert.Error(t, err)
+}
+
+func TestSQSServerScheduledAt(t *testing.T) {
+	srv := newSQSServer(t)
+	s := store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks"))
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email", ScheduledAt: time.Now().Add(time.Second)}))
+	_, err := s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(1100 * time.Millisecond)
+	task, err := s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
+
+func TestSQSServerErrors(t *testing.T) {
+	srv := newSQSServer(t)
+	client := srv.Client()
+	ctx := context.Background()
+	url := srv.CreateQueue("tasks.fifo")
+
+	_, err := client.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("{}")})
+	assertAPIError(t, err, "MissingParameter")
+
+	_, err = client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               aws.String(url),
+		MessageBody:            aws.String("{}"),
+		MessageGroupId:         aws.String("group"),
+		MessageDeduplicationId: aws.String("dedup"),
+		DelaySeconds:           5,
+	})
+	assertAPIError(t, err, "InvalidParameterValue")
+
+	_, err = client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(url),
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: aws.String("1"), MessageBody: aws.String("{}")},
+			{Id: aws.String("1"), MessageBody: aws.String("{}")},
+		},
+	})
+	assertAPIError(t, err, "AWS.SimpleQueueService.BatchEntryIdsNotDistinct")
+
+	_, err = client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(url), ReceiptHandle: aws.String("unknown")})
+	assertAPIError(t, err, "ReceiptHandleIsInvalid")
+
+	_, err = client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(srv.URL + "/000000000000/missing")})
+	assertAPIError(t, err, "AWS.SimpleQueueService.NonExistentQueue")
+}
+
+func assertAPIError(t *testing.T, err error, code string) {
+	t.Helper()
+	var apiErr smithy.APIError
+	if assert.ErrorAs(t, err, &apiErr) {
+		assert.Equal(t, code, apiErr.ErrorCode())
+	}
+}
+
+func TestSQSServerSkipsInvalidMessage(t *testing.T) {
+	srv := newSQSServer(t)
+	url := srv.CreateQueue("tasks")
+	s := store.NewSQSStore(srv.Client(), url)
+
+	_, err := srv.Client().SendMessage(context.Background(), &sqs.SendMessageInput{QueueUrl: aws.String(url), MessageBody: aws.String("not json")})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+
+	tasks, err := s.PopBatch(10)
+	assert.NoError(t, err)
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, "task-1", tasks[0].ID)
+	}
+}
+
+func TestSQSServerSubSecondNack(t *testing.T) {
+	srv := newSQSServer(t)
+	s := store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks"))
+
+	assert.NoError(t, s.Push(interfaces.Task{ID: "task-1", Name: "send_email"}))
+	task, err := s.Pop()
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Nack(task, 300*time.Millisecond))
+	_, err = s.Pop()
+	assert.Error(t, err)
+
+	time.Sleep(time.Second)
+	task, err = s.Pop()
+	assert.NoError(t, err)
+	assert.Equal(t, "task-1", task.ID)
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Thauan/gotsk"
+	"github.com/Thauan/gotsk/interfaces"
+	"github.com/Thauan/gotsk/sqstest"
+	"github.com/Thauan/gotsk/store"
+	"github.com/Thauan/gotsk/storetest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConformanceMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		return gotsk.NewMemoryStore()
+	})
+}
+
+func TestConformanceStoreMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		return store.NewMemoryStore()
+	})
+}
+
+func TestConformanceRedisStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		mr := miniredis.RunT(t)
+		return store.NewRedisStore(mr.Addr(), "", 0, "gotsk")
+	})
+}
+
+func TestConformanceRedisStreamStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		_, client := newStreamClient(t)
+		return store.NewRedisStreamStore(client, "tasks", store.WithClaimIdle(300*time.Millisecond))
+	}, storetest.WithLease(400*time.Millisecond))
+}
+
+func TestConformanceFileStore(t *testing.T) {
+	var dir string
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		dir = t.TempDir()
+		return newFileStore(t, dir)
+	}, storetest.WithRestart(func(t *testing.T, s interfaces.TaskStore) interfaces.TaskStore {
+		assert.NoError(t, s.(*store.FileStore).Close())
+		return newFileStore(t, dir)
+	}))
+}
+
+func TestConformanceBoltStore(t *testing.T) {
+	var path string
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		path = filepath.Join(t.TempDir(), "gotsk.db")
+		return newBoltStore(t, path, store.WithBoltLease(300*time.Millisecond))
+	},
+		storetest.WithPriority(),
+		storetest.WithLease(400*time.Millisecond),
+		storetest.WithRestart(func(t *testing.T, s interfaces.TaskStore) interfaces.TaskStore {
+			assert.NoError(t, s.(*store.BoltStore).Close())
+			return newBoltStore(t, path)
+		}),
+	)
+}
+
+func TestConformanceSQLStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		_, s := newSQLStore(t, store.WithLease(300*time.Millisecond))
+		return s
+	}, storetest.WithPriority(), storetest.WithLease(400*time.Millisecond))
+}
+
+func TestConformanceJetStreamStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		_, s := newJetStreamStore(300 * time.Millisecond)
+		return s
+	}, storetest.WithLease(400*time.Millisecond))
+}
+
+func TestConformanceSQSStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		srv := newSQSServer(t)
+		return store.NewSQSStore(srv.Client(), srv.CreateQueue("tasks", sqstest.WithVisibilityTimeout(time.Second)))
+	}, storetest.WithTick(time.Second), storetest.WithUnordered(), storetest.WithLease(time.Second))
+}
+
+func TestConformanceAMQPStore(t *testing.T) {
+	var broker *fakeBroker
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		broker = newFakeBroker()
+		return newAMQPStore(t, broker)
+	}, storetest.WithRestart(func(t *testing.T, s interfaces.TaskStore) interfaces.TaskStore {
+		assert.NoError(t, s.(*store.AMQPStore).Close())
+		return newAMQPStore(t, broker)
+	}))
+}
+
+func TestConformanceKafkaStore(t *testing.T) {
+	var kafka *fakeKafka
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		kafka = newFakeKafka(1)
+		return newKafkaStore(t, kafka)
+	}, storetest.WithRestart(func(t *testing.T, s interfaces.TaskStore) interfaces.TaskStore {
+		assert.NoError(t, s.(*store.KafkaStore).Close())
+		return newKafkaStore(t, kafka)
+	}))
+}
+
+func TestConformanceFailoverStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		fallback := newBoltStore(t, filepath.Join(t.TempDir(), "fallback.db"))
+		return newFailoverStore(t, store.NewMemoryStore(), fallback)
+	})
+}
+
+func TestConformanceShardedStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) interfaces.TaskStore {
+		_, shards := newShards(3)
+		return store.NewShardedStore(shards)
+	}, storetest.WithUnordered())
+}
@@ -19,33 +19,68 @@ func (q *Queue) worker() {
 			log.Printf("🛑 Worker %s encerrado", workerID)
 			return
 		default:
-			task, err := q.store.Pop()
-			if err != nil {
-				time.Sleep(500 * time.Millisecond)
+			if q.isPaused(pauseAll) || !q.inflight.begin() {
+				time.Sleep(pauseRetryDelay)
 				continue
 			}
 
-			if !task.ScheduledAt.IsZero() && task.ScheduledAt.After(time.Now()) {
-				_ = q.store.Push(task)
+			idle := q.poll(workerID)
+			q.inflight.end()
 
-				sleepFor := min(time.Until(task.ScheduledAt), time.Second)
-				time.Sleep(sleepFor)
-				continue
+			if idle > 0 {
+				select {
+				case <-time.After(idle):
+				case <-q.ready:
+				case <-q.ctx.Done():
+				}
 			}
-
-			q.process(task, workerID)
 		}
 	}
 }
 
-func (q *Queue) process(task interfaces.Task, workerID string) {
+func (q *Queue) poll(workerID string) time.Duration {
+	task, nq, err := q.pop()
+	if err != nil {
+		return 500 * time.Millisecond
+	}
+
+	if !task.ScheduledAt.IsZero() && task.ScheduledAt.After(time.Now()) {
+		q.postpone(nq, task, time.Until(task.ScheduledAt), workerID)
+		return 0
+	}
+
+	if q.isPaused(task.Name) {
+		q.postpone(nq, task, pauseRetryDelay, workerID)
+		return 0
+	}
+
+	release, delay, ok := q.admit(task.Name)
+	if !ok {
+		q.postpone(nq, task, delay, workerID)
+		return 0
+	}
+
+	succeeded := q.process(nq, task, workerID)
+	nq.finish(task, succeeded)
+	release()
+	return 0
+}
+
+func (q *Queue) postpone(nq *NamedQueue, task interfaces.Task, delay time.Duration, workerID string) {
+	if err := nq.Store.Nack(task, delay); err != nil {
+		log.Printf("⚠️ Worker %s: falha ao reenfileirar task %s: %v", workerID, task.ID, err)
+	}
+	nq.finish(task, false)
+}
+
+func (q *Queue) process(nq *NamedQueue, task interfaces.Task, workerID string) bool {
 	q.mu.RLock()
 	handler, ok := q.handlers[task.Name]
 	q.mu.RUnlock()
 
 	if !ok {
 		log.Printf("⚠️ Worker %s: handler não registrado para task '%s'", workerID, task.Name)
-		return
+		return false
 	}
 
 	for i := len(q.middlewares) - 1; i >= 0; i-- {
@@ -54,16 +89,54 @@ func (q *Queue) process(task interfaces.Task, workerID string) {
 
 	log.Printf("🚀 Worker %s: processando task %s (%s)", workerID, task.ID, task.Name)
 
+	rt := q.inflight.track(nq, task)
+	defer q.inflight.untrack(rt)
+
 	var err error
 	for attempt := 0; attempt <= q.maxRetries; attempt++ {
-		err = handler(q.ctx, task.Payload)
+		err = handler(q.taskCtx, task.Payload)
+		if rt.claimed.Load() {
+			log.Printf("⏹️ Worker %s: task %s interrompida no encerramento", workerID, task.ID)
+			return false
+		}
 		if err == nil {
-			q.store.Ack(task)
-			log.Printf("✅ Worker %s: task %s concluída", workerID, task.ID)
-			return
+			if rt.claim() {
+				if err := nq.ack(task); err != nil {
+					log.Printf("⚠️ Worker %s: falha ao confirmar task %s: %v", workerID, task.ID, err)
+				}
+				log.Printf("✅ Worker %s: task %s concluída", workerID, task.ID)
+			}
+			return true
 		}
 		log.Printf("❌ Worker %s: task %s falhou (tentativa %d): %v", workerID, task.ID, attempt+1, err)
-		time.Sleep(simpleBackoff(attempt))
+		if attempt == q.maxRetries {
+			break
+		}
+
+		select {
+		case <-time.After(simpleBackoff(attempt)):
+		case <-q.ctx.Done():
+			if rt.claim() {
+				q.interrupt(rt)
+			}
+			return false
+		}
 	}
 	log.Printf("💥 Worker %s: task %s falhou após %d tentativas", workerID, task.ID, q.maxRetries+1)
+
+	if dl, ok := nq.Store.(interfaces.DeadLetterer); ok && rt.claim() {
+		if err := dl.DeadLetter(task); err != nil {
+			log.Printf("⚠️ Worker %s: falha ao mover task %s para dead-letter: %v", workerID, task.ID, err)
+		}
+		return false
+	}
+
+	// A grouped task left pending would hold its group forever. Nacked, it
+	// stays ahead of the rest of its group and is tried again later.
+	if task.GroupKey != "" && rt.claim() {
+		if err := nq.Store.Nack(task, simpleBackoff(q.maxRetries)); err != nil {
+			log.Printf("⚠️ Worker %s: falha ao liberar grupo %s: %v", workerID, task.GroupKey, err)
+		}
+	}
+	return false
 }